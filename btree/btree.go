@@ -3,88 +3,91 @@ package btree
 import "github.com/google/btree"
 
 // BTree 是一个非线程安全的 B+ 树实现，用于高性能场景
-type BTree[K comparable] struct {
-	tree *btree.BTree
+type BTree[K comparable, V any] struct {
+	tree *btree.BTreeG[item[K, V]]
 	less LessFunc[K]
 }
 
 // NewNoLock 创建一个新的非线程安全的 B+ 树实例
-func NewNoLock[K comparable](degree int, less LessFunc[K]) *BTree[K] {
+func NewNoLock[K comparable, V any](degree int, less LessFunc[K]) *BTree[K, V] {
 	if degree < 2 {
 		panic("degree must >= 2")
 	}
-	return &BTree[K]{
-		tree: btree.New(degree),
+	return &BTree[K, V]{
+		tree: btree.NewG[item[K, V]](degree, itemLess[K, V](less)),
 		less: less,
 	}
 }
 
 // Insert 插入键值对（无锁）
-func (bt *BTree[K]) Insert(key K, value interface{}) {
-	item := &keyValueItem[K]{Key: key, Value: value, less: bt.less}
-	bt.tree.ReplaceOrInsert(item)
+func (bt *BTree[K, V]) Insert(key K, value V) {
+	bt.tree.ReplaceOrInsert(item[K, V]{Key: key, Value: value})
 }
 
 // Get 查找键对应的值（无锁）
-func (bt *BTree[K]) Get(key K) (interface{}, bool) {
-	item := &keyValueItem[K]{Key: key, less: bt.less}
-	found := bt.tree.Get(item)
-	if found == nil {
-		return nil, false
-	}
-	return found.(*keyValueItem[K]).Value, true
+func (bt *BTree[K, V]) Get(key K) (V, bool) {
+	found, ok := bt.tree.Get(item[K, V]{Key: key})
+	return found.Value, ok
 }
 
 // Delete 删除指定键（无锁）
-func (bt *BTree[K]) Delete(key K) {
-	item := &keyValueItem[K]{Key: key, less: bt.less}
-	bt.tree.Delete(item)
+func (bt *BTree[K, V]) Delete(key K) {
+	bt.tree.Delete(item[K, V]{Key: key})
 }
 
 // Size 返回当前树中的元素数量（无锁）
-func (bt *BTree[K]) Size() int {
+func (bt *BTree[K, V]) Size() int {
 	return bt.tree.Len()
 }
 
 // IsEmpty 判断是否为空（无锁）
-func (bt *BTree[K]) IsEmpty() bool {
+func (bt *BTree[K, V]) IsEmpty() bool {
 	return bt.Size() == 0
 }
 
-// Ascend 按升序遍历所有元素（无锁）
-func (bt *BTree[K]) Ascend(fn func(K, interface{})) {
-	bt.tree.Ascend(func(i btree.Item) bool {
-		item := i.(*keyValueItem[K])
-		fn(item.Key, item.Value)
-		return true
-	})
+// Ascend 按升序遍历所有元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) Ascend(fn func(K, V) bool) {
+	bt.tree.Ascend(visit(fn))
+}
+
+// AscendRange 按升序遍历半开区间 [start, end) 内的元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) AscendRange(start, end K, fn func(K, V) bool) {
+	bt.tree.AscendRange(item[K, V]{Key: start}, item[K, V]{Key: end}, visit(fn))
+}
+
+// AscendGreaterOrEqual 按升序遍历 [pivot, +∞) 内的元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) AscendGreaterOrEqual(pivot K, fn func(K, V) bool) {
+	bt.tree.AscendGreaterOrEqual(item[K, V]{Key: pivot}, visit(fn))
 }
 
-// AscendRange 遍历指定范围 [start, end]（无锁）
-func (bt *BTree[K]) AscendRange(start, end K, fn func(K, interface{})) {
-	startItem := &keyValueItem[K]{Key: start, less: bt.less}
-	endItem := &keyValueItem[K]{Key: end, less: bt.less}
+// AscendLessThan 按升序遍历 (-∞, pivot) 内的元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) AscendLessThan(pivot K, fn func(K, V) bool) {
+	bt.tree.AscendLessThan(item[K, V]{Key: pivot}, visit(fn))
+}
+
+// Descend 按降序遍历所有元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) Descend(fn func(K, V) bool) {
+	bt.tree.Descend(visit(fn))
+}
+
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即区间 (end, start]，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) DescendRange(start, end K, fn func(K, V) bool) {
+	bt.tree.DescendRange(item[K, V]{Key: start}, item[K, V]{Key: end}, visit(fn))
+}
 
-	bt.tree.AscendRange(startItem, endItem, func(i btree.Item) bool {
-		item := i.(*keyValueItem[K])
-		fn(item.Key, item.Value)
-		return true
-	})
+// DescendLessOrEqual 按降序遍历 (-∞, pivot] 内的元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) DescendLessOrEqual(pivot K, fn func(K, V) bool) {
+	bt.tree.DescendLessOrEqual(item[K, V]{Key: pivot}, visit(fn))
 }
 
-// Descend 按降序遍历所有元素（无锁）
-func (bt *BTree[K]) Descend(fn func(K, interface{})) {
-	bt.tree.Descend(func(i btree.Item) bool {
-		item := i.(*keyValueItem[K])
-		fn(item.Key, item.Value)
-		return true
-	})
+// DescendGreaterThan 按降序遍历 (pivot, +∞) 内的元素，fn 返回 false 时停止（无锁）
+func (bt *BTree[K, V]) DescendGreaterThan(pivot K, fn func(K, V) bool) {
+	bt.tree.DescendGreaterThan(item[K, V]{Key: pivot}, visit(fn))
 }
 
 // BatchInsert 批量插入键值对（无锁）
-func (bt *BTree[K]) BatchInsert(pairs map[K]interface{}) {
+func (bt *BTree[K, V]) BatchInsert(pairs map[K]V) {
 	for k, v := range pairs {
-		item := &keyValueItem[K]{Key: k, Value: v, less: bt.less}
-		bt.tree.ReplaceOrInsert(item)
+		bt.tree.ReplaceOrInsert(item[K, V]{Key: k, Value: v})
 	}
 }
@@ -7,135 +7,162 @@ import (
 )
 
 // KeyValue 是一个键值对结构
-type KeyValue[K comparable] struct {
+type KeyValue[K comparable, V any] struct {
 	Key   K
-	Value interface{}
+	Value V
 }
 
 // LessFunc 是自定义比较函数类型
 type LessFunc[K comparable] func(a, b K) bool
 
 // BTreeLock 是封装后的 B+ 树结构,加锁线程安全
-type BTreeLock[K comparable] struct {
-	tree  *btree.BTree
+type BTreeLock[K comparable, V any] struct {
+	tree  *btree.BTreeG[item[K, V]]
 	mutex *sync.RWMutex // 读写锁保证map插入线程安全
 	less  LessFunc[K]
 }
 
 // New 创建一个新的 BTreeLock 实例 (泛型函数)
 // 可以传入任意做key 需要传入一个比较传入泛型的比较方法
-func New[K comparable](degree int, less LessFunc[K]) *BTreeLock[K] {
+func New[K comparable, V any](degree int, less LessFunc[K]) *BTreeLock[K, V] {
 	if degree < 2 {
 		panic("degree must >= 2")
 	}
-	return &BTreeLock[K]{
-		tree:  btree.New(degree),
+	return &BTreeLock[K, V]{
+		tree:  btree.NewG[item[K, V]](degree, itemLess[K, V](less)),
 		mutex: &sync.RWMutex{},
 		less:  less,
 	}
 }
 
 // Insert 插入一个键值对
-func (bt *BTreeLock[K]) Insert(key K, value interface{}) {
-	item := &keyValueItem[K]{Key: key, Value: value, less: bt.less}
+func (bt *BTreeLock[K, V]) Insert(key K, value V) {
 	bt.mutex.Lock()
 	defer bt.mutex.Unlock()
-	bt.tree.ReplaceOrInsert(item)
+	bt.tree.ReplaceOrInsert(item[K, V]{Key: key, Value: value})
 }
 
 // Get 查找一个键对应的值
-func (bt *BTreeLock[K]) Get(key K) (interface{}, bool) {
-	item := &keyValueItem[K]{Key: key, less: bt.less}
+func (bt *BTreeLock[K, V]) Get(key K) (V, bool) {
 	bt.mutex.RLock()
 	defer bt.mutex.RUnlock()
-	found := bt.tree.Get(item)
-	if found == nil {
-		return nil, false
-	}
-	return found.(*keyValueItem[K]).Value, true
+	found, ok := bt.tree.Get(item[K, V]{Key: key})
+	return found.Value, ok
 }
 
 // Delete 删除一个键
-func (bt *BTreeLock[K]) Delete(key K) {
-	item := &keyValueItem[K]{Key: key, less: bt.less}
+func (bt *BTreeLock[K, V]) Delete(key K) {
 	bt.mutex.Lock()
 	defer bt.mutex.Unlock()
-	bt.tree.Delete(item)
+	bt.tree.Delete(item[K, V]{Key: key})
 }
 
 // Size 返回当前树中的元素数量
-func (bt *BTreeLock[K]) Size() int {
+func (bt *BTreeLock[K, V]) Size() int {
 	bt.mutex.RLock()
 	defer bt.mutex.RUnlock()
 	return bt.tree.Len()
 }
 
 // IsEmpty 判断是否为空
-func (bt *BTreeLock[K]) IsEmpty() bool {
+func (bt *BTreeLock[K, V]) IsEmpty() bool {
 	return bt.Size() == 0
 }
 
-// Ascend 按升序遍历所有元素
-func (bt *BTreeLock[K]) Ascend(fn func(key K, value interface{})) {
+// Ascend 按升序遍历所有元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) Ascend(fn func(key K, value V) bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	bt.tree.Ascend(visit(fn))
+}
+
+// AscendRange 按升序遍历半开区间 [start, end) 内的元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) AscendRange(start, end K, fn func(K, V) bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	bt.tree.AscendRange(item[K, V]{Key: start}, item[K, V]{Key: end}, visit(fn))
+}
+
+// AscendGreaterOrEqual 按升序遍历 [pivot, +∞) 内的元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) AscendGreaterOrEqual(pivot K, fn func(K, V) bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	bt.tree.AscendGreaterOrEqual(item[K, V]{Key: pivot}, visit(fn))
+}
+
+// AscendLessThan 按升序遍历 (-∞, pivot) 内的元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) AscendLessThan(pivot K, fn func(K, V) bool) {
 	bt.mutex.RLock()
 	defer bt.mutex.RUnlock()
-	bt.tree.Ascend(func(i btree.Item) bool {
-		item := i.(*keyValueItem[K])
-		fn(item.Key, item.Value)
-		return true
-	})
+	bt.tree.AscendLessThan(item[K, V]{Key: pivot}, visit(fn))
 }
 
-// AscendRange 遍历指定范围 [start, end]
-func (bt *BTreeLock[K]) AscendRange(start, end K, fn func(K, interface{})) {
-	startItem := &keyValueItem[K]{Key: start, less: bt.less}
-	endItem := &keyValueItem[K]{Key: end, less: bt.less}
+// Descend 按降序遍历所有元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) Descend(fn func(key K, value V) bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	bt.tree.Descend(visit(fn))
+}
 
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即区间 (end, start]，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) DescendRange(start, end K, fn func(K, V) bool) {
 	bt.mutex.RLock()
 	defer bt.mutex.RUnlock()
+	bt.tree.DescendRange(item[K, V]{Key: start}, item[K, V]{Key: end}, visit(fn))
+}
 
-	bt.tree.AscendRange(startItem, endItem, func(i btree.Item) bool {
-		item := i.(*keyValueItem[K])
-		fn(item.Key, item.Value)
-		return true
-	})
+// DescendLessOrEqual 按降序遍历 (-∞, pivot] 内的元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) DescendLessOrEqual(pivot K, fn func(K, V) bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	bt.tree.DescendLessOrEqual(item[K, V]{Key: pivot}, visit(fn))
 }
 
-// Descend 按降序遍历所有元素
-func (bt *BTreeLock[K]) Descend(fn func(key K, value interface{})) {
+// DescendGreaterThan 按降序遍历 (pivot, +∞) 内的元素，fn 返回 false 时停止
+// 遍历期间持有读锁，fn 中不能再调用写操作
+func (bt *BTreeLock[K, V]) DescendGreaterThan(pivot K, fn func(K, V) bool) {
 	bt.mutex.RLock()
 	defer bt.mutex.RUnlock()
-	bt.tree.Descend(func(i btree.Item) bool {
-		item := i.(*keyValueItem[K])
-		fn(item.Key, item.Value)
-		return true
-	})
+	bt.tree.DescendGreaterThan(item[K, V]{Key: pivot}, visit(fn))
 }
 
 // BatchInsert 批量插入键值对
-func (bt *BTreeLock[K]) BatchInsert(pairs map[K]interface{}) {
+func (bt *BTreeLock[K, V]) BatchInsert(pairs map[K]V) {
 	bt.mutex.Lock()
 	defer bt.mutex.Unlock()
 	for k, v := range pairs {
-		item := &keyValueItem[K]{Key: k, Value: v, less: bt.less}
-		bt.tree.ReplaceOrInsert(item)
+		bt.tree.ReplaceOrInsert(item[K, V]{Key: k, Value: v})
 	}
 }
 
-// keyValueItem 是内部使用的 Item 类型
-type keyValueItem[K comparable] struct {
+// item 是内部使用的元素类型，按值存储在 btree.BTreeG 中，查找时无需额外分配
+type item[K comparable, V any] struct {
 	Key   K
-	Value interface{}
-	less  LessFunc[K]
+	Value V
+}
+
+// itemLess 将键的比较函数转换为 btree.LessFunc
+func itemLess[K comparable, V any](less LessFunc[K]) btree.LessFunc[item[K, V]] {
+	return func(a, b item[K, V]) bool {
+		return less(a.Key, b.Key)
+	}
 }
 
-// Less 实现 btree.Item 接口
-func (i *keyValueItem[K]) Less(than btree.Item) bool {
-	other := than.(*keyValueItem[K])
-	return i.less(i.Key, other.Key)
+// visit 将用户的回调转换为 btree 的迭代函数
+func visit[K comparable, V any](fn func(K, V) bool) btree.ItemIteratorG[item[K, V]] {
+	return func(i item[K, V]) bool {
+		return fn(i.Key, i.Value)
+	}
 }
 
 // String 返回字符串表示
-func (i *keyValueItem[K]) String() string {
+func (i item[K, V]) String() string {
 	return fmt.Sprintf("{Key: %v}", i.Key)
 }
@@ -7,7 +7,7 @@ import (
 
 func TestBTree(t *testing.T) {
 	// 创建一个 BTree，键为 int，值为 string
-	bt := New[int](4, func(a, b int) bool {
+	bt := New[int, string](4, func(a, b int) bool {
 		return a < b
 	})
 	// 插入数据
@@ -22,21 +22,23 @@ func TestBTree(t *testing.T) {
 
 	// 遍历所有数据
 	fmt.Println("All items:")
-	bt.Ascend(func(k int, v interface{}) {
+	bt.Ascend(func(k int, v string) bool {
 		fmt.Printf("%d -> %s\n", k, v)
+		return true
 	})
 
-	// 范围查询 [5, 10]
-	fmt.Println("Range [5, 10]:")
-	bt.AscendRange(5, 10, func(k int, v interface{}) {
+	// 范围查询 [5, 10)
+	fmt.Println("Range [5, 10):")
+	bt.AscendRange(5, 10, func(k int, v string) bool {
 		fmt.Printf("%d -> %s\n", k, v)
+		return true
 	})
 
 	// 删除一个键
 	bt.Delete(5)
 
 	// 批量插入
-	bt.BatchInsert(map[int]interface{}{
+	bt.BatchInsert(map[int]string{
 		1: "one",
 		2: "two",
 		3: "three",
@@ -44,7 +46,167 @@ func TestBTree(t *testing.T) {
 
 	// 再次遍历
 	fmt.Println("After batch insert:")
-	bt.Ascend(func(k int, v interface{}) {
+	bt.Ascend(func(k int, v string) bool {
 		fmt.Printf("%d -> %s\n", k, v)
+		return true
 	})
 }
+
+// collect 收集遍历结果，最多 limit 个（limit <= 0 表示不限制）
+func collect(limit int, walk func(fn func(int, int) bool)) []int {
+	var keys []int
+	walk(func(k, _ int) bool {
+		keys = append(keys, k)
+		return limit <= 0 || len(keys) < limit
+	})
+	return keys
+}
+
+func TestRangeSemantics(t *testing.T) {
+	bt := NewNoLock[int, int](4, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 10; i++ {
+		bt.Insert(i, i*i)
+	}
+
+	cases := []struct {
+		name string
+		walk func(fn func(int, int) bool)
+		want []int
+	}{
+		{"AscendRange [3, 6)", func(fn func(int, int) bool) { bt.AscendRange(3, 6, fn) }, []int{3, 4, 5}},
+		{"AscendRange empty", func(fn func(int, int) bool) { bt.AscendRange(6, 6, fn) }, nil},
+		{"AscendGreaterOrEqual 7", func(fn func(int, int) bool) { bt.AscendGreaterOrEqual(7, fn) }, []int{7, 8, 9}},
+		{"AscendLessThan 3", func(fn func(int, int) bool) { bt.AscendLessThan(3, fn) }, []int{0, 1, 2}},
+		{"DescendRange (3, 6]", func(fn func(int, int) bool) { bt.DescendRange(6, 3, fn) }, []int{6, 5, 4}},
+		{"DescendLessOrEqual 2", func(fn func(int, int) bool) { bt.DescendLessOrEqual(2, fn) }, []int{2, 1, 0}},
+		{"DescendGreaterThan 6", func(fn func(int, int) bool) { bt.DescendGreaterThan(6, fn) }, []int{9, 8, 7}},
+	}
+	for _, c := range cases {
+		if got := collect(0, c.walk); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// 回调返回 false 时提前停止
+	if got := collect(2, bt.Ascend); fmt.Sprint(got) != "[0 1]" {
+		t.Errorf("Ascend with early stop = %v", got)
+	}
+	if got := collect(2, bt.Descend); fmt.Sprint(got) != "[9 8]" {
+		t.Errorf("Descend with early stop = %v", got)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	bt := New[int, int](4, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 10; i++ {
+		bt.Insert(i, i*i)
+	}
+
+	var keys []int
+	for k, v := range bt.All() {
+		if v != k*k {
+			t.Fatalf("value of %d = %d", k, v)
+		}
+		if k == 4 {
+			break
+		}
+		keys = append(keys, k)
+	}
+	if fmt.Sprint(keys) != "[0 1 2 3]" {
+		t.Errorf("All with break = %v", keys)
+	}
+
+	keys = keys[:0]
+	for k := range bt.Backward() {
+		keys = append(keys, k)
+	}
+	if fmt.Sprint(keys) != "[9 8 7 6 5 4 3 2 1 0]" {
+		t.Errorf("Backward = %v", keys)
+	}
+
+	keys = keys[:0]
+	for k := range bt.Range(2, 5) {
+		keys = append(keys, k)
+	}
+	if fmt.Sprint(keys) != "[2 3 4]" {
+		t.Errorf("Range [2, 5) = %v", keys)
+	}
+
+	// 迭代结束后读锁已释放
+	bt.Insert(10, 100)
+}
+
+func TestGetNoAlloc(t *testing.T) {
+	bt := NewNoLock[int, string](32, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 1000; i++ {
+		bt.Insert(i, "v")
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		bt.Get(500)
+		bt.Get(5000)
+	})
+	if allocs != 0 {
+		t.Fatalf("Get allocated %v times per run, want 0", allocs)
+	}
+}
+
+func BenchmarkBTreeInsert(b *testing.B) {
+	bt := NewNoLock[int, int](32, func(a, b int) bool {
+		return a < b
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bt.Insert(i%100000, i)
+	}
+}
+
+func BenchmarkBTreeGet(b *testing.B) {
+	bt := NewNoLock[int, int](32, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 100000; i++ {
+		bt.Insert(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bt.Get(i % 100000)
+	}
+}
+
+func BenchmarkBTreeLockGet(b *testing.B) {
+	bt := New[int, int](32, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 100000; i++ {
+		bt.Insert(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bt.Get(i % 100000)
+	}
+}
+
+func BenchmarkBTreeDelete(b *testing.B) {
+	bt := NewNoLock[int, int](32, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 100000; i++ {
+		bt.Insert(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := i % 100000
+		bt.Delete(k)
+		bt.Insert(k, k)
+	}
+}
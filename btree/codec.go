@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Codec 键或值的编解码器，用于快照和预写日志的持久化
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec 使用 encoding/json 编解码，适用于任意可 JSON 序列化的类型
+type JSONCodec[T any] struct{}
+
+// Marshal 实现 Codec 接口
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal 实现 Codec 接口
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// StringCodec 直接使用字符串的字节
+type StringCodec struct{}
+
+// Marshal 实现 Codec 接口
+func (StringCodec) Marshal(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+// Unmarshal 实现 Codec 接口
+func (StringCodec) Unmarshal(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// integer 所有整数类型
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// IntCodec 使用变长编码（varint）编解码整数
+type IntCodec[T integer] struct{}
+
+// Marshal 实现 Codec 接口
+func (IntCodec[T]) Marshal(v T) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(v)), nil
+}
+
+// Unmarshal 实现 Codec 接口
+func (IntCodec[T]) Unmarshal(data []byte) (T, error) {
+	v, n := binary.Varint(data)
+	if n <= 0 || n != len(data) {
+		return 0, errors.New("invalid varint")
+	}
+	return T(v), nil
+}
@@ -0,0 +1,429 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 预写日志（WAL）记录格式：
+//
+//	length uint32 | crc32 uint32 | payload
+//	payload = op uint8 | keyLen uvarint | key [| valueLen uvarint | value]
+//
+// 日志按段存放在 wal-<seq>.log 中，每次打开或 Checkpoint 都会切换到新的段。
+// 进程崩溃时最后一条记录可能只写了一半，这种记录只会出现在最后一个段的末尾，打开时会被截掉；
+// 其他位置出现不完整或校验失败的记录，或者长度超过 maxWALRecordSize 的记录说明日志已损坏，
+// 打开时返回 ErrCorruptedWAL。
+const (
+	snapshotFileName = "snapshot.db"
+	walFilePrefix    = "wal-"
+	walFileSuffix    = ".log"
+	maxWALRecordSize = 64 << 20 // 单条记录 payload 的最大长度
+
+	walOpInsert byte = 1
+	walOpDelete byte = 2
+)
+
+var (
+	// ErrClosed 对已关闭的 DurableBTree 进行写操作
+	ErrClosed = errors.New("durable btree is closed")
+	// ErrCorruptedWAL 日志中间出现不完整或校验失败的记录
+	ErrCorruptedWAL = errors.New("corrupted wal record")
+	// ErrRecordTooLarge 键和值编码后超过单条日志记录的最大长度
+	ErrRecordTooLarge = errors.New("wal record too large")
+)
+
+// durableOptions DurableBTree 的配置
+type durableOptions struct {
+	syncWrites bool
+}
+
+// DurableOption DurableBTree 的配置函数类型
+type DurableOption func(*durableOptions)
+
+// WithSyncWrites 每次写入日志后调用 fsync，机器掉电也不丢数据，但写入会明显变慢
+// 默认只保证进程崩溃时不丢数据
+func WithSyncWrites(sync bool) DurableOption {
+	return func(o *durableOptions) {
+		o.syncWrites = sync
+	}
+}
+
+// DurableBTree 带持久化的线程安全 B+ 树
+// 每次写操作先追加到预写日志再修改内存中的树，重启时加载最近的快照并回放日志，
+// 定期调用 Checkpoint 写出新快照并清理旧日志，可以缩短重启时的回放时间。
+type DurableBTree[K comparable, V any] struct {
+	tree       *BTreeLock[K, V]
+	dir        string
+	keyCodec   Codec[K]
+	valueCodec Codec[V]
+	options    durableOptions
+
+	mutex    sync.Mutex // 保证日志顺序与树的修改顺序一致
+	wal      *os.File
+	walSeq   uint64
+	walSize  int64    // 当前段中已成功写入的长度，写入失败时截断到这里
+	walErr   error    // 写入失败后无法截断，日志不再可信，之后的写操作都返回该错误
+	segments []uint64 // 尚未被快照覆盖的日志段，包括当前段
+	closed   bool
+
+	checkpointMutex sync.Mutex
+}
+
+// OpenDurable 打开 dir 下的持久化 B+ 树，目录不存在时自动创建
+func OpenDurable[K comparable, V any](dir string, degree int, less LessFunc[K], keyCodec Codec[K], valueCodec Codec[V], opts ...DurableOption) (*DurableBTree[K, V], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &DurableBTree[K, V]{
+		tree:       New[K, V](degree, less),
+		dir:        dir,
+		keyCodec:   keyCodec,
+		valueCodec: valueCodec,
+	}
+	for _, opt := range opts {
+		opt(&d.options)
+	}
+
+	if f, err := os.Open(filepath.Join(dir, snapshotFileName)); err == nil {
+		err = d.tree.Load(f, keyCodec, valueCodec)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("load snapshot: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, seq := range segments {
+		if err := d.replay(seq, i == len(segments)-1); err != nil {
+			return nil, fmt.Errorf("replay %s: %w", segmentName(seq), err)
+		}
+	}
+	d.segments = segments
+
+	next := uint64(1)
+	if len(segments) > 0 {
+		next = segments[len(segments)-1] + 1
+	}
+	if err := d.openSegment(next); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Insert 插入一个键值对，写入日志失败时树保持不变
+func (d *DurableBTree[K, V]) Insert(key K, value V) error {
+	kb, err := d.keyCodec.Marshal(key)
+	if err != nil {
+		return err
+	}
+	vb, err := d.valueCodec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	payload := append([]byte{walOpInsert}, binary.AppendUvarint(nil, uint64(len(kb)))...)
+	payload = append(payload, kb...)
+	payload = binary.AppendUvarint(payload, uint64(len(vb)))
+	payload = append(payload, vb...)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := d.append(payload); err != nil {
+		return err
+	}
+	d.tree.Insert(key, value)
+	return nil
+}
+
+// Delete 删除一个键，写入日志失败时树保持不变
+func (d *DurableBTree[K, V]) Delete(key K) error {
+	kb, err := d.keyCodec.Marshal(key)
+	if err != nil {
+		return err
+	}
+	payload := append([]byte{walOpDelete}, binary.AppendUvarint(nil, uint64(len(kb)))...)
+	payload = append(payload, kb...)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := d.append(payload); err != nil {
+		return err
+	}
+	d.tree.Delete(key)
+	return nil
+}
+
+// Get 查找一个键对应的值
+func (d *DurableBTree[K, V]) Get(key K) (V, bool) {
+	return d.tree.Get(key)
+}
+
+// Size 返回当前树中的元素数量
+func (d *DurableBTree[K, V]) Size() int {
+	return d.tree.Size()
+}
+
+// IsEmpty 判断是否为空
+func (d *DurableBTree[K, V]) IsEmpty() bool {
+	return d.tree.IsEmpty()
+}
+
+// Snapshot 创建当前时刻的只读快照，用于遍历和范围查询
+func (d *DurableBTree[K, V]) Snapshot() *Snapshot[K, V] {
+	return d.tree.Snapshot()
+}
+
+// Checkpoint 将当前内容写成新的快照文件，并删除已被快照覆盖的日志段
+// 快照写入磁盘期间不阻塞读写操作
+func (d *DurableBTree[K, V]) Checkpoint() error {
+	d.checkpointMutex.Lock()
+	defer d.checkpointMutex.Unlock()
+
+	// 在写锁内同时获取快照并切换日志段，保证快照恰好包含旧段中的所有写入
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return ErrClosed
+	}
+	snap := d.tree.Snapshot()
+	covered := d.segments
+	oldWAL := d.wal
+	if err := d.openSegment(d.walSeq + 1); err != nil {
+		d.mutex.Unlock()
+		return err
+	}
+	d.segments = []uint64{d.walSeq}
+	d.mutex.Unlock()
+
+	err := oldWAL.Close()
+	if err == nil {
+		err = d.writeSnapshotFile(snap)
+	}
+	if err != nil {
+		// 旧段没有被快照覆盖，仍需保留以便重启时回放
+		d.mutex.Lock()
+		d.segments = append(covered, d.segments...)
+		d.mutex.Unlock()
+		return err
+	}
+	for _, seq := range covered {
+		if err := os.Remove(filepath.Join(d.dir, segmentName(seq))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭日志文件，之后的写操作会返回 ErrClosed
+func (d *DurableBTree[K, V]) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	return d.wal.Close()
+}
+
+// append 追加一条记录，失败时把段截断回写入前的长度，
+// 避免之后的记录跟在半条记录后面，或者返回失败的记录在重启后又被回放
+func (d *DurableBTree[K, V]) append(payload []byte) error {
+	if d.closed {
+		return ErrClosed
+	}
+	if d.walErr != nil {
+		return d.walErr
+	}
+	if len(payload) > maxWALRecordSize {
+		return fmt.Errorf("%w: %d bytes", ErrRecordTooLarge, len(payload))
+	}
+	record := binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))
+	record = binary.LittleEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+	_, err := d.wal.Write(record)
+	if err == nil && d.options.syncWrites {
+		err = d.wal.Sync()
+	}
+	if err != nil {
+		truncErr := d.wal.Truncate(d.walSize)
+		if truncErr == nil && d.options.syncWrites {
+			truncErr = d.wal.Sync()
+		}
+		if truncErr != nil {
+			d.walErr = fmt.Errorf("wal %s is inconsistent after failed write: %w", segmentName(d.walSeq), errors.Join(err, truncErr))
+		}
+		return err
+	}
+	d.walSize += int64(len(record))
+	return nil
+}
+
+func (d *DurableBTree[K, V]) openSegment(seq uint64) error {
+	f, err := os.OpenFile(filepath.Join(d.dir, segmentName(seq)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	d.wal = f
+	d.walSeq = seq
+	d.walSize = info.Size()
+	d.segments = append(d.segments, seq)
+	return nil
+}
+
+// replay 回放一个日志段
+// 只有最后一个段末尾写了一半的记录才是崩溃造成的：记录头不完整，或者记录一直延伸到段末尾且校验失败，
+// 这种记录截掉后继续；其他损坏，包括长度超过上限的记录头，都返回 ErrCorruptedWAL，不截断文件
+func (d *DurableBTree[K, V]) replay(seq uint64, last bool) error {
+	name := filepath.Join(d.dir, segmentName(seq))
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		rest := data[offset:]
+		if len(rest) >= 8 {
+			length := binary.LittleEndian.Uint32(rest[0:4])
+			sum := binary.LittleEndian.Uint32(rest[4:8])
+			// 长度字段损坏时不能把后面的记录当作半条记录截掉
+			if length > maxWALRecordSize {
+				return fmt.Errorf("%w at offset %d: length %d exceeds limit", ErrCorruptedWAL, offset, length)
+			}
+			if len(rest)-8 >= int(length) {
+				payload := rest[8 : 8+length]
+				if crc32.ChecksumIEEE(payload) == sum {
+					if err := d.apply(payload); err != nil {
+						return err
+					}
+					offset += 8 + int(length)
+					continue
+				}
+				// 校验失败的记录后面还有数据，不是写入时崩溃造成的
+				if len(rest)-8 > int(length) {
+					return fmt.Errorf("%w at offset %d", ErrCorruptedWAL, offset)
+				}
+			}
+		}
+		// 记录头不完整，或者记录一直延伸到段末尾，是写入时崩溃留下的半条记录
+		if !last {
+			return fmt.Errorf("%w at offset %d", ErrCorruptedWAL, offset)
+		}
+		// 截掉半条记录，否则之后新建段时它会变成日志中间的损坏记录
+		return os.Truncate(name, int64(offset))
+	}
+	return nil
+}
+
+func (d *DurableBTree[K, V]) apply(payload []byte) error {
+	if len(payload) == 0 {
+		return errors.New("empty wal record")
+	}
+	r := bytes.NewReader(payload[1:])
+	kb, err := readChunk(r)
+	if err != nil {
+		return err
+	}
+	key, err := d.keyCodec.Unmarshal(kb)
+	if err != nil {
+		return err
+	}
+	switch payload[0] {
+	case walOpInsert:
+		vb, err := readChunk(r)
+		if err != nil {
+			return err
+		}
+		value, err := d.valueCodec.Unmarshal(vb)
+		if err != nil {
+			return err
+		}
+		d.tree.Insert(key, value)
+	case walOpDelete:
+		d.tree.Delete(key)
+	default:
+		return fmt.Errorf("unknown wal op %d", payload[0])
+	}
+	return nil
+}
+
+// writeSnapshotFile 先写临时文件再原子重命名，避免崩溃时留下半个快照
+func (d *DurableBTree[K, V]) writeSnapshotFile(snap *Snapshot[K, V]) error {
+	tmp, err := os.CreateTemp(d.dir, snapshotFileName+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = snap.tree.Save(tmp, d.keyCodec, d.valueCodec); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(d.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	return syncDir(d.dir)
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%s%016d%s", walFilePrefix, seq, walFileSuffix)
+}
+
+// listSegments 返回目录中所有日志段的序号，按升序排列
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, walFilePrefix) || !strings.HasSuffix(name, walFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walFilePrefix), walFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+	return segments, nil
+}
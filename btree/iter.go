@@ -0,0 +1,48 @@
+package btree
+
+import "iter"
+
+// All 返回按升序遍历所有元素的迭代器（无锁）
+func (bt *BTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		bt.Ascend(yield)
+	}
+}
+
+// Backward 返回按降序遍历所有元素的迭代器（无锁）
+func (bt *BTree[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		bt.Descend(yield)
+	}
+}
+
+// Range 返回按升序遍历半开区间 [start, end) 的迭代器（无锁）
+func (bt *BTree[K, V]) Range(start, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		bt.AscendRange(start, end, yield)
+	}
+}
+
+// All 返回按升序遍历所有元素的迭代器
+// 迭代期间持有读锁，循环体中不能再调用写操作
+func (bt *BTreeLock[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		bt.Ascend(yield)
+	}
+}
+
+// Backward 返回按降序遍历所有元素的迭代器
+// 迭代期间持有读锁，循环体中不能再调用写操作
+func (bt *BTreeLock[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		bt.Descend(yield)
+	}
+}
+
+// Range 返回按升序遍历半开区间 [start, end) 的迭代器
+// 迭代期间持有读锁，循环体中不能再调用写操作
+func (bt *BTreeLock[K, V]) Range(start, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		bt.AscendRange(start, end, yield)
+	}
+}
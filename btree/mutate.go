@@ -0,0 +1,246 @@
+package btree
+
+import "github.com/google/btree"
+
+// Min 返回最小的键值对，树为空时 ok 为 false（无锁）
+func (bt *BTree[K, V]) Min() (key K, value V, ok bool) {
+	return unpack(bt.tree.Min())
+}
+
+// Max 返回最大的键值对，树为空时 ok 为 false（无锁）
+func (bt *BTree[K, V]) Max() (key K, value V, ok bool) {
+	return unpack(bt.tree.Max())
+}
+
+// DeleteMin 删除并返回最小的键值对，树为空时 ok 为 false（无锁）
+func (bt *BTree[K, V]) DeleteMin() (key K, value V, ok bool) {
+	return unpack(bt.tree.DeleteMin())
+}
+
+// DeleteMax 删除并返回最大的键值对，树为空时 ok 为 false（无锁）
+func (bt *BTree[K, V]) DeleteMax() (key K, value V, ok bool) {
+	return unpack(bt.tree.DeleteMax())
+}
+
+// DeleteRange 删除半开区间 [start, end) 内的所有元素，返回删除的数量（无锁）
+func (bt *BTree[K, V]) DeleteRange(start, end K) int {
+	return deleteRange(bt.tree, start, end)
+}
+
+// GetOrInsert 键存在时返回已有的值且 loaded 为 true，否则插入 value 并返回它（无锁）
+func (bt *BTree[K, V]) GetOrInsert(key K, value V) (actual V, loaded bool) {
+	return getOrInsert(bt.tree, key, value)
+}
+
+// Update 以 fn 的返回值更新 key 对应的值（无锁）
+// fn 的参数为当前值及其是否存在；fn 返回 keep 为 false 时删除该键（键不存在时不插入）
+// 返回更新后的值及其是否存在
+func (bt *BTree[K, V]) Update(key K, fn func(value V, exists bool) (newValue V, keep bool)) (V, bool) {
+	return update(bt.tree, key, fn)
+}
+
+// BatchInsertSorted 按 pairs 的顺序逐个插入键值对（无锁）
+// 通常传入按键升序排列的切片，但不要求有序，也不会利用有序性加速插入，未排序的输入结果相同
+// 键重复时后出现的值覆盖先出现的值
+func (bt *BTree[K, V]) BatchInsertSorted(pairs []KeyValue[K, V]) {
+	batchInsertSorted(bt.tree, pairs)
+}
+
+// Min 返回最小的键值对，树为空时 ok 为 false
+func (bt *BTreeLock[K, V]) Min() (key K, value V, ok bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	return unpack(bt.tree.Min())
+}
+
+// Max 返回最大的键值对，树为空时 ok 为 false
+func (bt *BTreeLock[K, V]) Max() (key K, value V, ok bool) {
+	bt.mutex.RLock()
+	defer bt.mutex.RUnlock()
+	return unpack(bt.tree.Max())
+}
+
+// DeleteMin 删除并返回最小的键值对，树为空时 ok 为 false
+// 可以把树当作优先队列使用，多个消费者并发调用时每个元素只会被取出一次
+func (bt *BTreeLock[K, V]) DeleteMin() (key K, value V, ok bool) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	return unpack(bt.tree.DeleteMin())
+}
+
+// DeleteMax 删除并返回最大的键值对，树为空时 ok 为 false
+func (bt *BTreeLock[K, V]) DeleteMax() (key K, value V, ok bool) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	return unpack(bt.tree.DeleteMax())
+}
+
+// DeleteRange 删除半开区间 [start, end) 内的所有元素，返回删除的数量
+// 例如以过期时间为键时，DeleteRange(最小时间, now) 即可清理所有已过期的元素
+func (bt *BTreeLock[K, V]) DeleteRange(start, end K) int {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	return deleteRange(bt.tree, start, end)
+}
+
+// GetOrInsert 键存在时返回已有的值且 loaded 为 true，否则插入 value 并返回它
+func (bt *BTreeLock[K, V]) GetOrInsert(key K, value V) (actual V, loaded bool) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	return getOrInsert(bt.tree, key, value)
+}
+
+// Update 在写锁内以 fn 的返回值更新 key 对应的值，读取和写入之间不会被其他写操作打断
+// fn 的参数为当前值及其是否存在；fn 返回 keep 为 false 时删除该键（键不存在时不插入）
+// 返回更新后的值及其是否存在。fn 中不能再调用该树的任何方法
+func (bt *BTreeLock[K, V]) Update(key K, fn func(value V, exists bool) (newValue V, keep bool)) (V, bool) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	return update(bt.tree, key, fn)
+}
+
+// BatchInsertSorted 按 pairs 的顺序逐个插入键值对，整批只加一次写锁
+// 通常传入按键升序排列的切片，但不要求有序，也不会利用有序性加速插入，未排序的输入结果相同
+// 键重复时后出现的值覆盖先出现的值
+func (bt *BTreeLock[K, V]) BatchInsertSorted(pairs []KeyValue[K, V]) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	batchInsertSorted(bt.tree, pairs)
+}
+
+// Min 返回所有分片中最小的键值对，树为空时 ok 为 false
+// 依次读取各分片的最小值，不是原子的，并发写入时结果可能已经过时
+func (st *ShardedBTree[K, V]) Min() (key K, value V, ok bool) {
+	_, key, value, ok = st.extreme((*BTreeLock[K, V]).Min, st.less)
+	return
+}
+
+// Max 返回所有分片中最大的键值对，树为空时 ok 为 false
+// 依次读取各分片的最大值，不是原子的，并发写入时结果可能已经过时
+func (st *ShardedBTree[K, V]) Max() (key K, value V, ok bool) {
+	_, key, value, ok = st.extreme((*BTreeLock[K, V]).Max, st.greater)
+	return
+}
+
+// DeleteMin 删除并返回最小的键值对，树为空时 ok 为 false
+// 先找出最小值所在的分片再在该分片上删除，多个消费者并发调用时每个元素只会被取出一次，
+// 但并发写入时取出的不一定是全局最小的元素
+func (st *ShardedBTree[K, V]) DeleteMin() (key K, value V, ok bool) {
+	return st.deleteExtreme((*BTreeLock[K, V]).Min, (*BTreeLock[K, V]).DeleteMin, st.less)
+}
+
+// DeleteMax 删除并返回最大的键值对，树为空时 ok 为 false
+// 与 DeleteMin 相同，并发写入时取出的不一定是全局最大的元素
+func (st *ShardedBTree[K, V]) DeleteMax() (key K, value V, ok bool) {
+	return st.deleteExtreme((*BTreeLock[K, V]).Max, (*BTreeLock[K, V]).DeleteMax, st.greater)
+}
+
+// DeleteRange 删除半开区间 [start, end) 内的所有元素，返回删除的数量
+// 依次在每个分片上删除，各分片分别加锁，整体不是原子的
+func (st *ShardedBTree[K, V]) DeleteRange(start, end K) int {
+	n := 0
+	for _, s := range st.shards {
+		n += s.DeleteRange(start, end)
+	}
+	return n
+}
+
+// GetOrInsert 键存在时返回已有的值且 loaded 为 true，否则插入 value 并返回它
+func (st *ShardedBTree[K, V]) GetOrInsert(key K, value V) (actual V, loaded bool) {
+	return st.shardOf(key).GetOrInsert(key, value)
+}
+
+// Update 在 key 所在分片的写锁内以 fn 的返回值更新 key 对应的值，语义与 BTreeLock.Update 相同
+// fn 中不能再调用该树的任何方法
+func (st *ShardedBTree[K, V]) Update(key K, fn func(value V, exists bool) (newValue V, keep bool)) (V, bool) {
+	return st.shardOf(key).Update(key, fn)
+}
+
+// BatchInsertSorted 按 pairs 的顺序插入键值对，先按分片分组并保持组内顺序，每个分片只加一次锁
+// 不要求 pairs 有序；键重复时后出现的值覆盖先出现的值
+func (st *ShardedBTree[K, V]) BatchInsertSorted(pairs []KeyValue[K, V]) {
+	groups := make([][]KeyValue[K, V], len(st.shards))
+	for _, p := range pairs {
+		i := st.shard(p.Key, len(st.shards))
+		groups[i] = append(groups[i], p)
+	}
+	for i, group := range groups {
+		if len(group) > 0 {
+			st.shards[i].BatchInsertSorted(group)
+		}
+	}
+}
+
+func (st *ShardedBTree[K, V]) greater(a, b K) bool {
+	return st.less(b, a)
+}
+
+// extreme 返回 peek 结果中按 better 排在最前的键值对及其所在的分片
+func (st *ShardedBTree[K, V]) extreme(peek func(*BTreeLock[K, V]) (K, V, bool), better LessFunc[K]) (shard *BTreeLock[K, V], key K, value V, ok bool) {
+	for _, s := range st.shards {
+		k, v, found := peek(s)
+		if found && (!ok || better(k, key)) {
+			shard, key, value, ok = s, k, v, true
+		}
+	}
+	return
+}
+
+// deleteExtreme 在 peek 选出的分片上调用 remove，该分片在此期间被其他协程取空时重新选择
+func (st *ShardedBTree[K, V]) deleteExtreme(peek, remove func(*BTreeLock[K, V]) (K, V, bool), better LessFunc[K]) (K, V, bool) {
+	for {
+		shard, key, value, ok := st.extreme(peek, better)
+		if !ok {
+			return key, value, false
+		}
+		if key, value, ok = remove(shard); ok {
+			return key, value, true
+		}
+	}
+}
+
+// unpack 将 btree 返回的元素拆成键值对
+func unpack[K comparable, V any](i item[K, V], ok bool) (K, V, bool) {
+	return i.Key, i.Value, ok
+}
+
+func deleteRange[K comparable, V any](tree *btree.BTreeG[item[K, V]], start, end K) int {
+	// 遍历期间不能修改树，先收集再删除
+	var keys []item[K, V]
+	tree.AscendRange(item[K, V]{Key: start}, item[K, V]{Key: end}, func(i item[K, V]) bool {
+		keys = append(keys, item[K, V]{Key: i.Key})
+		return true
+	})
+	for _, k := range keys {
+		tree.Delete(k)
+	}
+	return len(keys)
+}
+
+func getOrInsert[K comparable, V any](tree *btree.BTreeG[item[K, V]], key K, value V) (V, bool) {
+	if found, ok := tree.Get(item[K, V]{Key: key}); ok {
+		return found.Value, true
+	}
+	tree.ReplaceOrInsert(item[K, V]{Key: key, Value: value})
+	return value, false
+}
+
+func update[K comparable, V any](tree *btree.BTreeG[item[K, V]], key K, fn func(V, bool) (V, bool)) (V, bool) {
+	found, exists := tree.Get(item[K, V]{Key: key})
+	value, keep := fn(found.Value, exists)
+	if !keep {
+		if exists {
+			tree.Delete(item[K, V]{Key: key})
+		}
+		var zero V
+		return zero, false
+	}
+	tree.ReplaceOrInsert(item[K, V]{Key: key, Value: value})
+	return value, true
+}
+
+func batchInsertSorted[K comparable, V any](tree *btree.BTreeG[item[K, V]], pairs []KeyValue[K, V]) {
+	for _, p := range pairs {
+		tree.ReplaceOrInsert(item[K, V]{Key: p.Key, Value: p.Value})
+	}
+}
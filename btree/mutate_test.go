@@ -0,0 +1,129 @@
+package btree
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMinMaxDelete(t *testing.T) {
+	bt := NewNoLock[int, int](4, intLess)
+	if _, _, ok := bt.Min(); ok {
+		t.Fatalf("Min of empty tree should report !ok")
+	}
+	if _, _, ok := bt.DeleteMax(); ok {
+		t.Fatalf("DeleteMax of empty tree should report !ok")
+	}
+	for i := 0; i < 10; i++ {
+		bt.Insert(i, i*10)
+	}
+	if k, v, ok := bt.Min(); !ok || k != 0 || v != 0 {
+		t.Fatalf("Min = %d, %d, %v", k, v, ok)
+	}
+	if k, v, ok := bt.Max(); !ok || k != 9 || v != 90 {
+		t.Fatalf("Max = %d, %d, %v", k, v, ok)
+	}
+	if k, _, _ := bt.DeleteMin(); k != 0 {
+		t.Fatalf("DeleteMin = %d, want 0", k)
+	}
+	if k, _, _ := bt.DeleteMax(); k != 9 {
+		t.Fatalf("DeleteMax = %d, want 9", k)
+	}
+
+	if n := bt.DeleteRange(3, 6); n != 3 {
+		t.Fatalf("DeleteRange removed %d, want 3", n)
+	}
+	if n := bt.DeleteRange(6, 3); n != 0 {
+		t.Fatalf("DeleteRange with start > end removed %d, want 0", n)
+	}
+	if got, want := collect(-1, bt.Ascend), []int{1, 2, 6, 7, 8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestGetOrInsertUpdate(t *testing.T) {
+	bt := New[string, int](4, func(a, b string) bool { return a < b })
+	if v, loaded := bt.GetOrInsert("a", 1); loaded || v != 1 {
+		t.Fatalf("GetOrInsert new = %d, %v", v, loaded)
+	}
+	if v, loaded := bt.GetOrInsert("a", 2); !loaded || v != 1 {
+		t.Fatalf("GetOrInsert existing = %d, %v", v, loaded)
+	}
+
+	incr := func(v int, _ bool) (int, bool) { return v + 1, true }
+	if v, ok := bt.Update("a", incr); !ok || v != 2 {
+		t.Fatalf("Update existing = %d, %v", v, ok)
+	}
+	if v, ok := bt.Update("b", incr); !ok || v != 1 {
+		t.Fatalf("Update missing = %d, %v", v, ok)
+	}
+	remove := func(v int, _ bool) (int, bool) { return v, false }
+	if _, ok := bt.Update("a", remove); ok {
+		t.Fatalf("Update returning keep=false should delete")
+	}
+	if _, ok := bt.Get("a"); ok {
+		t.Fatalf("key a should be deleted")
+	}
+	if _, ok := bt.Update("missing", remove); ok || bt.Size() != 1 {
+		t.Fatalf("Update of missing key with keep=false must not insert")
+	}
+}
+
+func TestUpdateAtomic(t *testing.T) {
+	bt := New[int, int](4, intLess)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				bt.Update(0, func(v int, _ bool) (int, bool) { return v + 1, true })
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := bt.Get(0); v != 8000 {
+		t.Fatalf("counter = %d, want 8000", v)
+	}
+}
+
+func TestDeleteMinQueue(t *testing.T) {
+	bt := New[int, int](4, intLess)
+	pairs := make([]KeyValue[int, int], 0, 1000)
+	for i := 0; i < 1000; i++ {
+		pairs = append(pairs, KeyValue[int, int]{Key: i, Value: i})
+	}
+	bt.BatchInsertSorted(pairs)
+	if bt.Size() != 1000 {
+		t.Fatalf("size = %d, want 1000", bt.Size())
+	}
+
+	// 多个消费者并发出队，每个元素恰好被取出一次
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[int]bool)
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				k, _, ok := bt.DeleteMin()
+				if !ok {
+					return
+				}
+				mu.Lock()
+				if seen[k] {
+					t.Errorf("key %d popped twice", k)
+				}
+				seen[k] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 1000 || !bt.IsEmpty() {
+		t.Fatalf("popped %d keys, remaining %d", len(seen), bt.Size())
+	}
+}
@@ -0,0 +1,41 @@
+package btree
+
+import (
+	"testing"
+
+	"github.com/lwm-galactic/tools/orderedmap"
+	"github.com/lwm-galactic/tools/orderedmap/orderedmaptest"
+)
+
+var (
+	_ orderedmap.OrderedMap[int, int] = (*BTree[int, int])(nil)
+	_ orderedmap.OrderedMap[int, int] = (*BTreeLock[int, int])(nil)
+)
+
+func intLess(a, b int) bool {
+	return a < b
+}
+
+func newBTree() orderedmap.OrderedMap[int, int] {
+	return NewNoLock[int, int](4, intLess)
+}
+
+func newBTreeLock() orderedmap.OrderedMap[int, int] {
+	return New[int, int](4, intLess)
+}
+
+func TestBTreeOrderedMap(t *testing.T) {
+	orderedmaptest.Run(t, newBTree)
+}
+
+func TestBTreeLockOrderedMap(t *testing.T) {
+	orderedmaptest.Run(t, newBTreeLock)
+}
+
+func FuzzBTree(f *testing.F) {
+	orderedmaptest.Fuzz(f, newBTree)
+}
+
+func FuzzBTreeLock(f *testing.F) {
+	orderedmaptest.Fuzz(f, newBTreeLock)
+}
@@ -0,0 +1,242 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// 快照文件格式（版本 1）：
+//
+//	magic "BTSN" | version uint8 | count uvarint |
+//	count 个 (keyLen uvarint | key | valueLen uvarint | value) |
+//	crc32 uint32（小端，覆盖前面所有字节）
+//
+// 元素按键升序写出，加载时可以顺序插入。
+const (
+	snapshotMagic   = "BTSN"
+	snapshotVersion = 1
+)
+
+var (
+	// ErrInvalidSnapshot 快照格式错误或校验失败
+	ErrInvalidSnapshot = errors.New("invalid btree snapshot")
+	// ErrUnsupportedVersion 快照版本不受支持
+	ErrUnsupportedVersion = errors.New("unsupported btree snapshot version")
+)
+
+// Save 将所有元素以快照格式写入 w（无锁）
+func (bt *BTree[K, V]) Save(w io.Writer, keyCodec Codec[K], valueCodec Codec[V]) error {
+	return writeSnapshot(w, bt.Size(), bt.Ascend, keyCodec, valueCodec)
+}
+
+// Load 从 r 读取快照并替换当前所有元素，读取失败时树保持不变（无锁）
+func (bt *BTree[K, V]) Load(r io.Reader, keyCodec Codec[K], valueCodec Codec[V]) error {
+	items, err := readSnapshot(r, keyCodec, valueCodec)
+	if err != nil {
+		return err
+	}
+	bt.tree.Clear(false)
+	for _, i := range items {
+		bt.tree.ReplaceOrInsert(i)
+	}
+	return nil
+}
+
+// Save 将所有元素以快照格式写入 w
+// 写出的是调用时刻的写时复制快照，写入磁盘期间不阻塞其他读写操作
+func (bt *BTreeLock[K, V]) Save(w io.Writer, keyCodec Codec[K], valueCodec Codec[V]) error {
+	return bt.Snapshot().tree.Save(w, keyCodec, valueCodec)
+}
+
+// Load 从 r 读取快照并替换当前所有元素，读取失败时树保持不变
+func (bt *BTreeLock[K, V]) Load(r io.Reader, keyCodec Codec[K], valueCodec Codec[V]) error {
+	items, err := readSnapshot(r, keyCodec, valueCodec)
+	if err != nil {
+		return err
+	}
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	bt.tree.Clear(false)
+	for _, i := range items {
+		bt.tree.ReplaceOrInsert(i)
+	}
+	return nil
+}
+
+// Save 将所有元素按键的顺序以快照格式写入 w，格式与 BTreeLock.Save 相同
+// 写出的是调用时刻各分片的写时复制快照，写入磁盘期间不阻塞其他读写操作
+func (st *ShardedBTree[K, V]) Save(w io.Writer, keyCodec Codec[K], valueCodec Codec[V]) error {
+	snap := st.Snapshot()
+	return writeSnapshot(w, snap.Size(), snap.Ascend, keyCodec, valueCodec)
+}
+
+// Load 从 r 读取快照并替换当前所有元素，读取失败时树保持不变
+// 替换期间持有所有分片的写锁，其他协程看不到只替换了一部分分片的状态
+func (st *ShardedBTree[K, V]) Load(r io.Reader, keyCodec Codec[K], valueCodec Codec[V]) error {
+	items, err := readSnapshot(r, keyCodec, valueCodec)
+	if err != nil {
+		return err
+	}
+	for _, s := range st.shards {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+	}
+	for _, s := range st.shards {
+		s.tree.Clear(false)
+	}
+	for _, i := range items {
+		st.shardOf(i.Key).tree.ReplaceOrInsert(i)
+	}
+	return nil
+}
+
+func writeSnapshot[K comparable, V any](w io.Writer, size int, ascend func(func(K, V) bool), keyCodec Codec[K], valueCodec Codec[V]) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	header := append([]byte(snapshotMagic), snapshotVersion)
+	header = binary.AppendUvarint(header, uint64(size))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	var err error
+	ascend(func(k K, v V) bool {
+		err = writeEntry(bw, k, v, keyCodec, valueCodec)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	_, err = w.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32()))
+	return err
+}
+
+func writeEntry[K comparable, V any](w io.Writer, k K, v V, keyCodec Codec[K], valueCodec Codec[V]) error {
+	kb, err := keyCodec.Marshal(k)
+	if err != nil {
+		return fmt.Errorf("marshal key %v: %w", k, err)
+	}
+	vb, err := valueCodec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal value of key %v: %w", k, err)
+	}
+	buf := binary.AppendUvarint(nil, uint64(len(kb)))
+	buf = append(buf, kb...)
+	buf = binary.AppendUvarint(buf, uint64(len(vb)))
+	buf = append(buf, vb...)
+	_, err = w.Write(buf)
+	return err
+}
+
+func readSnapshot[K comparable, V any](r io.Reader, keyCodec Codec[K], valueCodec Codec[V]) ([]item[K, V], error) {
+	crc := crc32.NewIEEE()
+	br := &checksumReader{r: bufio.NewReader(r), crc: crc}
+
+	magic := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if string(magic[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+	if version := magic[len(snapshotMagic)]; version != snapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	items := make([]item[K, V], 0, min(count, 1<<20))
+	for n := uint64(0); n < count; n++ {
+		k, v, err := readEntry(br, keyCodec, valueCodec)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item[K, V]{Key: k, Value: v})
+	}
+
+	sum := crc.Sum32()
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(br.r, trailer); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if binary.LittleEndian.Uint32(trailer) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+	return items, nil
+}
+
+func readEntry[K comparable, V any](r byteReader, keyCodec Codec[K], valueCodec Codec[V]) (K, V, error) {
+	var (
+		k K
+		v V
+	)
+	kb, err := readChunk(r)
+	if err != nil {
+		return k, v, err
+	}
+	vb, err := readChunk(r)
+	if err != nil {
+		return k, v, err
+	}
+	if k, err = keyCodec.Unmarshal(kb); err != nil {
+		return k, v, fmt.Errorf("unmarshal key: %w", err)
+	}
+	if v, err = valueCodec.Unmarshal(vb); err != nil {
+		return k, v, fmt.Errorf("unmarshal value of key %v: %w", k, err)
+	}
+	return k, v, nil
+}
+
+// byteReader 同时支持按块和按字节读取
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readChunk 读取一段以 uvarint 长度为前缀的数据
+// 不按声明的长度预先分配内存，避免损坏的数据导致巨大的分配
+func readChunk(r byteReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if uint64(len(buf)) != n {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, io.ErrUnexpectedEOF)
+	}
+	return buf, nil
+}
+
+// checksumReader 在读取的同时计算校验和
+type checksumReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc.Write(p[:n])
+	return n, err
+}
+
+func (c *checksumReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.crc.Write([]byte{b})
+	}
+	return b, err
+}
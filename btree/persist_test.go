@@ -0,0 +1,271 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	src := New[int, string](4, intLess)
+	for i := 0; i < 1000; i++ {
+		src.Insert(i, strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	if err := src.Save(&buf, IntCodec[int]{}, StringCodec{}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data := buf.Bytes()
+
+	dst := NewNoLock[int, string](8, intLess)
+	dst.Insert(-1, "stale")
+	if err := dst.Load(bytes.NewReader(data), IntCodec[int]{}, StringCodec{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if dst.Size() != 1000 {
+		t.Fatalf("size = %d, want 1000", dst.Size())
+	}
+	if _, ok := dst.Get(-1); ok {
+		t.Fatalf("Load must replace existing content")
+	}
+	if v, ok := dst.Get(999); !ok || v != "999" {
+		t.Fatalf("Get(999) = %q, %v", v, ok)
+	}
+
+	// 任意一个字节损坏都能被发现，且树保持不变
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	if err := dst.Load(bytes.NewReader(corrupted), IntCodec[int]{}, StringCodec{}); err == nil {
+		t.Fatalf("Load should reject corrupted snapshot")
+	}
+	if dst.Size() != 1000 {
+		t.Fatalf("failed Load must not modify the tree")
+	}
+
+	future := append([]byte(nil), data...)
+	future[len(snapshotMagic)] = snapshotVersion + 1
+	if err := dst.Load(bytes.NewReader(future), IntCodec[int]{}, StringCodec{}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("Load of future version = %v, want ErrUnsupportedVersion", err)
+	}
+	if err := dst.Load(bytes.NewReader(data[:len(data)-1]), IntCodec[int]{}, StringCodec{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("Load of truncated snapshot = %v, want ErrInvalidSnapshot", err)
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	type point struct{ X, Y int }
+	src := NewNoLock[string, point](4, func(a, b string) bool { return a < b })
+	src.Insert("a", point{1, 2})
+	src.Insert("b", point{3, 4})
+
+	var buf bytes.Buffer
+	if err := src.Save(&buf, StringCodec{}, JSONCodec[point]{}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	dst := New[string, point](4, func(a, b string) bool { return a < b })
+	if err := dst.Load(&buf, StringCodec{}, JSONCodec[point]{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if v, ok := dst.Get("b"); !ok || v != (point{3, 4}) {
+		t.Fatalf("Get(b) = %v, %v", v, ok)
+	}
+}
+
+func openDurable(t *testing.T, dir string) *DurableBTree[int, int] {
+	t.Helper()
+	d, err := OpenDurable[int, int](dir, 4, intLess, IntCodec[int]{}, IntCodec[int]{})
+	if err != nil {
+		t.Fatalf("OpenDurable: %v", err)
+	}
+	return d
+}
+
+func TestDurableRecovery(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 100; i++ {
+		if err := d.Insert(i, i); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	if err := d.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := d.Delete(i); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+	if err := d.Insert(1000, 1); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	// 模拟崩溃：不调用 Close，并在日志末尾留下半条记录
+	segments, _ := listSegments(dir)
+	last := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	f.Write([]byte{42, 0, 0, 0, 1, 2})
+	f.Close()
+
+	d2 := openDurable(t, dir)
+	defer d2.Close()
+	if d2.Size() != 51 {
+		t.Fatalf("recovered size = %d, want 51", d2.Size())
+	}
+	if _, ok := d2.Get(10); ok {
+		t.Fatalf("deleted key 10 came back after recovery")
+	}
+	if v, ok := d2.Get(1000); !ok || v != 1 {
+		t.Fatalf("Get(1000) = %d, %v", v, ok)
+	}
+
+	// Checkpoint 之后只保留当前日志段
+	if err := d2.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if segments, _ := listSegments(dir); len(segments) != 1 {
+		t.Fatalf("segments after checkpoint = %v", segments)
+	}
+	if err := d2.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := d2.Insert(1, 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Insert after Close = %v, want ErrClosed", err)
+	}
+
+	d3 := openDurable(t, dir)
+	defer d3.Close()
+	if d3.Size() != 51 {
+		t.Fatalf("size after checkpoint and reopen = %d, want 51", d3.Size())
+	}
+}
+
+func TestDurableTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 10; i++ {
+		if err := d.Insert(i, i); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	// 模拟写入时崩溃，段末尾留下半条记录
+	segments, _ := listSegments(dir)
+	torn := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	f, err := os.OpenFile(torn, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	f.Write([]byte{42, 0, 0, 0, 1, 2})
+	f.Close()
+	d.Close()
+
+	// 重新打开时截掉半条记录，之后的写入在新的段中，再次打开时全部回放
+	d2 := openDurable(t, dir)
+	for i := 10; i < 20; i++ {
+		if err := d2.Insert(i, i); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	if err := d2.Delete(0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	d2.Close()
+	d3 := openDurable(t, dir)
+	if d3.Size() != 19 {
+		t.Fatalf("size after reopen = %d, want 19", d3.Size())
+	}
+	if _, ok := d3.Get(0); ok {
+		t.Fatalf("deleted key 0 came back")
+	}
+	if v, ok := d3.Get(19); !ok || v != 19 {
+		t.Fatalf("Get(19) = %d, %v", v, ok)
+	}
+	d3.Close()
+
+	// 不是最后一个段的末尾出现损坏时返回错误，而不是静默丢掉后面的记录
+	data, err := os.ReadFile(torn)
+	if err != nil {
+		t.Fatalf("read wal: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(torn, data, 0o644); err != nil {
+		t.Fatalf("write wal: %v", err)
+	}
+	if _, err := OpenDurable[int, int](dir, 4, intLess, IntCodec[int]{}, IntCodec[int]{}); !errors.Is(err, ErrCorruptedWAL) {
+		t.Fatalf("OpenDurable with corrupted wal = %v, want ErrCorruptedWAL", err)
+	}
+}
+
+func TestDurableCorruptedLength(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 10; i++ {
+		if err := d.Insert(i, i); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	d.Close()
+	segments, _ := listSegments(dir)
+	name := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read wal: %v", err)
+	}
+	// 最后一个段中间记录的长度字段损坏，不能当作半条记录把后面的数据截掉
+	second := 8 + int(binary.LittleEndian.Uint32(data[0:4]))
+	for _, length := range []uint32{0xfffffff0, 1} {
+		corrupted := bytes.Clone(data)
+		binary.LittleEndian.PutUint32(corrupted[second:], length)
+		if err := os.WriteFile(name, corrupted, 0o644); err != nil {
+			t.Fatalf("write wal: %v", err)
+		}
+		if _, err := OpenDurable[int, int](dir, 4, intLess, IntCodec[int]{}, IntCodec[int]{}); !errors.Is(err, ErrCorruptedWAL) {
+			t.Fatalf("OpenDurable with length %#x = %v, want ErrCorruptedWAL", length, err)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("stat wal: %v", err)
+		}
+		if info.Size() != int64(len(data)) {
+			t.Fatalf("corrupted wal must not be truncated, size %d, want %d", info.Size(), len(data))
+		}
+	}
+}
+
+func TestDurableFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	if err := d.Insert(1, 1); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	// 换成只读的文件句柄，写入和截断都会失败
+	readOnly, err := os.Open(d.wal.Name())
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	d.wal.Close()
+	d.wal = readOnly
+	if err := d.Insert(2, 2); err == nil {
+		t.Fatalf("Insert should fail")
+	}
+	if _, ok := d.Get(2); ok {
+		t.Fatalf("failed Insert must not change the tree")
+	}
+	// 无法截断时日志不再可信，之后的写入都失败
+	if err := d.Insert(3, 3); err == nil {
+		t.Fatalf("Insert after unrecoverable failure should fail")
+	}
+	d.Close()
+
+	d2 := openDurable(t, dir)
+	defer d2.Close()
+	if d2.Size() != 1 {
+		t.Fatalf("size after reopen = %d, want 1", d2.Size())
+	}
+}
@@ -0,0 +1,405 @@
+package btree
+
+import (
+	"container/heap"
+	"iter"
+	"sort"
+)
+
+// ShardFunc 将键映射到 [0, shards) 中的某个分片
+type ShardFunc[K comparable] func(key K, shards int) int
+
+// HashShard 按哈希值取模分片，写入在各分片间分布均匀，适合写多的场景
+func HashShard[K comparable](hash func(K) uint64) ShardFunc[K] {
+	return func(key K, shards int) int {
+		return int(hash(key) % uint64(shards))
+	}
+}
+
+// RangeShard 按键范围分片，bounds 为升序排列的分界点：
+// 小于 bounds[0] 的键落在分片 0，[bounds[i-1], bounds[i]) 落在分片 i，其余落在最后一个分片。
+// 分片数应为 len(bounds)+1，多出的分界点会归入最后一个分片。
+func RangeShard[K comparable](less LessFunc[K], bounds ...K) ShardFunc[K] {
+	return func(key K, shards int) int {
+		i := sort.Search(len(bounds), func(i int) bool {
+			return less(key, bounds[i])
+		})
+		if i >= shards {
+			i = shards - 1
+		}
+		return i
+	}
+}
+
+// ShardedBTree 分片的线程安全 B+ 树
+// 由 N 个独立加锁的 BTreeLock 组成，不同分片上的写操作互不阻塞，适合多协程写多的场景。
+// 有序遍历按批在各分片的读锁下读取并按键归并，回调期间不持有锁，也不会触发写时复制。
+// 跨分片的操作（Size、遍历）不是原子的，需要一致的视图时使用 Snapshot。
+type ShardedBTree[K comparable, V any] struct {
+	shards []*BTreeLock[K, V]
+	shard  ShardFunc[K]
+	less   LessFunc[K]
+}
+
+// NewSharded 创建一个有 shards 个分片的 ShardedBTree 实例
+func NewSharded[K comparable, V any](shards, degree int, less LessFunc[K], shard ShardFunc[K]) *ShardedBTree[K, V] {
+	if shards < 1 {
+		panic("shards must >= 1")
+	}
+	st := &ShardedBTree[K, V]{
+		shards: make([]*BTreeLock[K, V], shards),
+		shard:  shard,
+		less:   less,
+	}
+	for i := range st.shards {
+		st.shards[i] = New[K, V](degree, less)
+	}
+	return st
+}
+
+func (st *ShardedBTree[K, V]) shardOf(key K) *BTreeLock[K, V] {
+	return st.shards[st.shard(key, len(st.shards))]
+}
+
+// Insert 插入一个键值对
+func (st *ShardedBTree[K, V]) Insert(key K, value V) {
+	st.shardOf(key).Insert(key, value)
+}
+
+// Get 查找一个键对应的值
+func (st *ShardedBTree[K, V]) Get(key K) (V, bool) {
+	return st.shardOf(key).Get(key)
+}
+
+// Delete 删除一个键
+func (st *ShardedBTree[K, V]) Delete(key K) {
+	st.shardOf(key).Delete(key)
+}
+
+// Size 返回所有分片的元素数量之和
+func (st *ShardedBTree[K, V]) Size() int {
+	size := 0
+	for _, s := range st.shards {
+		size += s.Size()
+	}
+	return size
+}
+
+// IsEmpty 判断是否为空
+func (st *ShardedBTree[K, V]) IsEmpty() bool {
+	return st.Size() == 0
+}
+
+// BatchInsert 批量插入键值对，先按分片分组，每个分片只加一次锁
+func (st *ShardedBTree[K, V]) BatchInsert(pairs map[K]V) {
+	groups := make([]map[K]V, len(st.shards))
+	for k, v := range pairs {
+		i := st.shard(k, len(st.shards))
+		if groups[i] == nil {
+			groups[i] = make(map[K]V)
+		}
+		groups[i][k] = v
+	}
+	for i, group := range groups {
+		if len(group) > 0 {
+			st.shards[i].BatchInsert(group)
+		}
+	}
+}
+
+// Snapshot 对每个分片创建写时复制快照，返回合并后的只读视图
+func (st *ShardedBTree[K, V]) Snapshot() *ShardedSnapshot[K, V] {
+	snapshots := make([]*Snapshot[K, V], len(st.shards))
+	for i, s := range st.shards {
+		snapshots[i] = s.Snapshot()
+	}
+	return &ShardedSnapshot[K, V]{shards: snapshots, shard: st.shard, less: st.less}
+}
+
+// Ascend 按升序遍历所有元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) Ascend(fn func(key K, value V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{ascending: true}, fn)
+}
+
+// AscendRange 按升序遍历半开区间 [start, end) 内的元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) AscendRange(start, end K, fn func(K, V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{ascending: true, from: &start, inclusive: true, to: &end}, fn)
+}
+
+// AscendGreaterOrEqual 按升序遍历 [pivot, +∞) 内的元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) AscendGreaterOrEqual(pivot K, fn func(K, V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{ascending: true, from: &pivot, inclusive: true}, fn)
+}
+
+// AscendLessThan 按升序遍历 (-∞, pivot) 内的元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) AscendLessThan(pivot K, fn func(K, V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{ascending: true, to: &pivot}, fn)
+}
+
+// Descend 按降序遍历所有元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) Descend(fn func(key K, value V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{}, fn)
+}
+
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即区间 (end, start]，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) DescendRange(start, end K, fn func(K, V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{from: &start, inclusive: true, to: &end}, fn)
+}
+
+// DescendLessOrEqual 按降序遍历 (-∞, pivot] 内的元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) DescendLessOrEqual(pivot K, fn func(K, V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{from: &pivot, inclusive: true}, fn)
+}
+
+// DescendGreaterThan 按降序遍历 (pivot, +∞) 内的元素，fn 返回 false 时停止
+func (st *ShardedBTree[K, V]) DescendGreaterThan(pivot K, fn func(K, V) bool) {
+	mergeShards(st.shards, st.less, scanRange[K]{to: &pivot}, fn)
+}
+
+// All 返回按升序遍历所有元素的迭代器
+func (st *ShardedBTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		st.Ascend(yield)
+	}
+}
+
+// Backward 返回按降序遍历所有元素的迭代器
+func (st *ShardedBTree[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		st.Descend(yield)
+	}
+}
+
+// Range 返回按升序遍历半开区间 [start, end) 的迭代器
+func (st *ShardedBTree[K, V]) Range(start, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		st.AscendRange(start, end, yield)
+	}
+}
+
+// ShardedSnapshot 是 ShardedBTree 的只读视图，遍历时按键归并各分片的快照
+type ShardedSnapshot[K comparable, V any] struct {
+	shards []*Snapshot[K, V]
+	shard  ShardFunc[K]
+	less   LessFunc[K]
+}
+
+// Get 查找键对应的值
+func (s *ShardedSnapshot[K, V]) Get(key K) (V, bool) {
+	return s.shards[s.shard(key, len(s.shards))].Get(key)
+}
+
+// Size 返回快照中的元素数量
+func (s *ShardedSnapshot[K, V]) Size() int {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+// IsEmpty 判断快照是否为空
+func (s *ShardedSnapshot[K, V]) IsEmpty() bool {
+	return s.Size() == 0
+}
+
+// Ascend 按升序遍历所有元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) Ascend(fn func(key K, value V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{ascending: true}, fn)
+}
+
+// AscendRange 按升序遍历半开区间 [start, end) 内的元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) AscendRange(start, end K, fn func(K, V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{ascending: true, from: &start, inclusive: true, to: &end}, fn)
+}
+
+// AscendGreaterOrEqual 按升序遍历 [pivot, +∞) 内的元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) AscendGreaterOrEqual(pivot K, fn func(K, V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{ascending: true, from: &pivot, inclusive: true}, fn)
+}
+
+// AscendLessThan 按升序遍历 (-∞, pivot) 内的元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) AscendLessThan(pivot K, fn func(K, V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{ascending: true, to: &pivot}, fn)
+}
+
+// Descend 按降序遍历所有元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) Descend(fn func(key K, value V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{}, fn)
+}
+
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即区间 (end, start]，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) DescendRange(start, end K, fn func(K, V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{from: &start, inclusive: true, to: &end}, fn)
+}
+
+// DescendLessOrEqual 按降序遍历 (-∞, pivot] 内的元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) DescendLessOrEqual(pivot K, fn func(K, V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{from: &pivot, inclusive: true}, fn)
+}
+
+// DescendGreaterThan 按降序遍历 (pivot, +∞) 内的元素，fn 返回 false 时停止
+func (s *ShardedSnapshot[K, V]) DescendGreaterThan(pivot K, fn func(K, V) bool) {
+	mergeShards(s.shards, s.less, scanRange[K]{to: &pivot}, fn)
+}
+
+// All 返回按升序遍历所有元素的迭代器
+func (s *ShardedSnapshot[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		s.Ascend(yield)
+	}
+}
+
+// Backward 返回按降序遍历所有元素的迭代器
+func (s *ShardedSnapshot[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		s.Descend(yield)
+	}
+}
+
+// Range 返回按升序遍历半开区间 [start, end) 的迭代器
+func (s *ShardedSnapshot[K, V]) Range(start, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		s.AscendRange(start, end, yield)
+	}
+}
+
+// mergeBatchSize 归并时每次从一个分片读取的元素数量
+const mergeBatchSize = 256
+
+// orderedShard 归并遍历需要的分片方法，BTreeLock 和 Snapshot 都实现了它
+type orderedShard[K comparable, V any] interface {
+	Ascend(fn func(K, V) bool)
+	AscendGreaterOrEqual(pivot K, fn func(K, V) bool)
+	Descend(fn func(K, V) bool)
+	DescendLessOrEqual(pivot K, fn func(K, V) bool)
+}
+
+// scanRange 遍历的范围，升序时 from 是下界，降序时 from 是上界；to 总是不包含的终点
+type scanRange[K comparable] struct {
+	ascending bool
+	from      *K // nil 表示不限
+	inclusive bool
+	to        *K // nil 表示不限
+}
+
+// scanBatch 按 r 从分片读取最多 limit 个元素，BTreeLock 只在读取这一批时持有读锁
+func scanBatch[K comparable, V any](shard orderedShard[K, V], less LessFunc[K], r scanRange[K], limit int) []KeyValue[K, V] {
+	var batch []KeyValue[K, V]
+	visit := func(k K, v V) bool {
+		if r.from != nil && !r.inclusive && !less(*r.from, k) && !less(k, *r.from) {
+			return true
+		}
+		if r.to != nil && (r.ascending && !less(k, *r.to) || !r.ascending && !less(*r.to, k)) {
+			return false
+		}
+		batch = append(batch, KeyValue[K, V]{Key: k, Value: v})
+		return len(batch) < limit
+	}
+	switch {
+	case r.ascending && r.from == nil:
+		shard.Ascend(visit)
+	case r.ascending:
+		shard.AscendGreaterOrEqual(*r.from, visit)
+	case r.from == nil:
+		shard.Descend(visit)
+	default:
+		shard.DescendLessOrEqual(*r.from, visit)
+	}
+	return batch
+}
+
+// mergeShards 按批读取每个分片，并用小顶堆（降序时为大顶堆）把各分片的结果按键归并后交给 fn
+// 每个键只属于一个分片，因此归并结果中不会出现重复的键；fn 执行期间不持有任何锁，
+// 下一批从上一批最后一个键之后继续读取，因此遍历期间的写入可能被看到，但结果始终有序
+func mergeShards[S orderedShard[K, V], K comparable, V any](shards []S, less LessFunc[K], r scanRange[K], fn func(K, V) bool) {
+	h := &mergeHeap[K, V]{less: less, ascending: r.ascending}
+	for _, shard := range shards {
+		c := &mergeCursor[K, V]{scan: r, fetch: func(r scanRange[K]) []KeyValue[K, V] {
+			return scanBatch[K, V](shard, less, r, mergeBatchSize)
+		}}
+		if c.refill() {
+			h.cursors = append(h.cursors, c)
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		top := h.cursors[0]
+		kv := top.batch[top.pos]
+		if !fn(kv.Key, kv.Value) {
+			return
+		}
+		if top.advance() {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+}
+
+// mergeCursor 归并时某个分片的当前批次和位置
+type mergeCursor[K comparable, V any] struct {
+	scan  scanRange[K] // 读取下一批的范围
+	fetch func(scanRange[K]) []KeyValue[K, V]
+	batch []KeyValue[K, V]
+	pos   int
+}
+
+// refill 读取下一批，分片中已没有更多元素时返回 false
+func (c *mergeCursor[K, V]) refill() bool {
+	c.batch, c.pos = c.fetch(c.scan), 0
+	if len(c.batch) == 0 {
+		return false
+	}
+	last := c.batch[len(c.batch)-1].Key
+	c.scan.from, c.scan.inclusive = &last, false
+	return true
+}
+
+// advance 移动到下一个元素，当前批次用完时读取下一批
+func (c *mergeCursor[K, V]) advance() bool {
+	c.pos++
+	if c.pos < len(c.batch) {
+		return true
+	}
+	if len(c.batch) < mergeBatchSize {
+		return false
+	}
+	return c.refill()
+}
+
+func (c *mergeCursor[K, V]) key() K {
+	return c.batch[c.pos].Key
+}
+
+// mergeHeap 实现 heap.Interface，按当前键排序各分片的游标
+type mergeHeap[K comparable, V any] struct {
+	cursors   []*mergeCursor[K, V]
+	less      LessFunc[K]
+	ascending bool
+}
+
+func (h *mergeHeap[K, V]) Len() int {
+	return len(h.cursors)
+}
+
+func (h *mergeHeap[K, V]) Less(i, j int) bool {
+	if h.ascending {
+		return h.less(h.cursors[i].key(), h.cursors[j].key())
+	}
+	return h.less(h.cursors[j].key(), h.cursors[i].key())
+}
+
+func (h *mergeHeap[K, V]) Swap(i, j int) {
+	h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i]
+}
+
+func (h *mergeHeap[K, V]) Push(x any) {
+	h.cursors = append(h.cursors, x.(*mergeCursor[K, V]))
+}
+
+func (h *mergeHeap[K, V]) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
@@ -0,0 +1,321 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/murmur3"
+	"github.com/lwm-galactic/tools/orderedmap"
+	"github.com/lwm-galactic/tools/orderedmap/orderedmaptest"
+)
+
+var _ orderedmap.OrderedMap[int, int] = (*ShardedBTree[int, int])(nil)
+
+func intHash(k int) uint64 {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(k))
+	return murmur3.Sum64(buf[:])
+}
+
+func newHashSharded() orderedmap.OrderedMap[int, int] {
+	return NewSharded[int, int](8, 4, intLess, HashShard[int](intHash))
+}
+
+func newRangeSharded() orderedmap.OrderedMap[int, int] {
+	return NewSharded[int, int](4, 4, intLess, RangeShard[int](intLess, 100, 300, 600))
+}
+
+func TestShardedOrderedMap(t *testing.T) {
+	t.Run("Hash", func(t *testing.T) {
+		orderedmaptest.Run(t, newHashSharded)
+	})
+	t.Run("Range", func(t *testing.T) {
+		orderedmaptest.Run(t, newRangeSharded)
+	})
+}
+
+func FuzzSharded(f *testing.F) {
+	orderedmaptest.Fuzz(f, newHashSharded)
+}
+
+func TestRangeShard(t *testing.T) {
+	shard := RangeShard[int](intLess, 10, 20)
+	cases := map[int]int{-5: 0, 9: 0, 10: 1, 19: 1, 20: 2, 100: 2}
+	for key, want := range cases {
+		if got := shard(key, 3); got != want {
+			t.Errorf("shard(%d) = %d, want %d", key, got, want)
+		}
+	}
+	if got := shard(100, 2); got != 1 {
+		t.Errorf("extra bounds should fall into the last shard, got %d", got)
+	}
+}
+
+func TestShardedConcurrentWrites(t *testing.T) {
+	st := NewSharded[int, int](8, 16, intLess, HashShard[int](intHash))
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				st.Insert(w*1000+i, i)
+			}
+		}(w)
+	}
+	// 遍历与写入并发进行，结果必须始终有序
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			prev := -1
+			for k := range st.All() {
+				if k <= prev {
+					t.Errorf("merged iteration out of order: %d after %d", k, prev)
+					return
+				}
+				prev = k
+			}
+		}
+	}()
+	wg.Wait()
+
+	if st.Size() != 8000 {
+		t.Fatalf("size = %d, want 8000", st.Size())
+	}
+}
+
+func TestShardedIterationReleasesLocks(t *testing.T) {
+	st := NewSharded[int, int](4, 4, intLess, HashShard[int](intHash))
+	for i := 0; i < 100; i++ {
+		st.Insert(i, i)
+	}
+	// 提前结束遍历后所有分片的读锁都已释放，写入不会阻塞
+	for k := range st.All() {
+		if k == 10 {
+			break
+		}
+	}
+	st.Descend(func(k, v int) bool {
+		return k > 90
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 100; i < 200; i++ {
+			st.Insert(i, i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("writes blocked after iteration stopped")
+	}
+
+	// 回调期间不持有锁，可以写入正在遍历的树
+	n := 0
+	st.Ascend(func(k, v int) bool {
+		st.Delete(k)
+		n++
+		return true
+	})
+	if n != 200 || !st.IsEmpty() {
+		t.Fatalf("visited %d, size after delete %d", n, st.Size())
+	}
+}
+
+func TestShardedMergeBatches(t *testing.T) {
+	// 单个分片中的元素多于一批，归并需要跨批次续读
+	const n = 3*mergeBatchSize + 7
+	st := NewSharded[int, int](2, 4, intLess, RangeShard[int](intLess, n/3))
+	for i := 0; i < n; i++ {
+		st.Insert(i, i)
+	}
+	check := func(name string, got []int, from, to, step int) {
+		t.Helper()
+		want := (to-from)/step + 1
+		if len(got) != want {
+			t.Fatalf("%s visited %d keys, want %d", name, len(got), want)
+		}
+		for i, k := range got {
+			if k != from+i*step {
+				t.Fatalf("%s key[%d] = %d, want %d", name, i, k, from+i*step)
+			}
+		}
+	}
+	check("Ascend", collect(-1, st.Ascend), 0, n-1, 1)
+	check("Descend", collect(-1, st.Descend), n-1, 0, -1)
+	check("AscendRange", collect(-1, func(fn func(int, int) bool) { st.AscendRange(100, 700, fn) }), 100, 699, 1)
+	check("DescendRange", collect(-1, func(fn func(int, int) bool) { st.DescendRange(700, 100, fn) }), 700, 101, -1)
+	check("AscendGreaterOrEqual", collect(-1, func(fn func(int, int) bool) { st.AscendGreaterOrEqual(500, fn) }), 500, n-1, 1)
+	check("DescendLessOrEqual", collect(-1, func(fn func(int, int) bool) { st.DescendLessOrEqual(500, fn) }), 500, 0, -1)
+	check("AscendLessThan", collect(-1, func(fn func(int, int) bool) { st.AscendLessThan(300, fn) }), 0, 299, 1)
+	check("DescendGreaterThan", collect(-1, func(fn func(int, int) bool) { st.DescendGreaterThan(300, fn) }), n-1, 301, -1)
+
+	snap := st.Snapshot()
+	for i := 0; i < n; i++ {
+		st.Delete(i)
+	}
+	check("Snapshot.Ascend", collect(-1, snap.Ascend), 0, n-1, 1)
+	check("Snapshot.DescendRange", collect(-1, func(fn func(int, int) bool) { snap.DescendRange(700, 100, fn) }), 700, 101, -1)
+}
+
+func TestShardedMutate(t *testing.T) {
+	st := NewSharded[int, int](4, 4, intLess, HashShard[int](intHash))
+	if _, _, ok := st.Min(); ok {
+		t.Fatalf("Min of empty tree should report !ok")
+	}
+	if _, _, ok := st.DeleteMax(); ok {
+		t.Fatalf("DeleteMax of empty tree should report !ok")
+	}
+	// 未排序和重复的键按出现顺序插入
+	st.BatchInsertSorted([]KeyValue[int, int]{{Key: 5, Value: 0}, {Key: 0, Value: 0}, {Key: 9, Value: 90}, {Key: 5, Value: 50}})
+	for i := 1; i < 9; i++ {
+		if i != 5 {
+			st.Insert(i, i*10)
+		}
+	}
+	if v, _ := st.Get(5); v != 50 {
+		t.Fatalf("Get(5) = %d, want the later value 50", v)
+	}
+	if k, v, ok := st.Min(); !ok || k != 0 || v != 0 {
+		t.Fatalf("Min = %d, %d, %v", k, v, ok)
+	}
+	if k, v, ok := st.Max(); !ok || k != 9 || v != 90 {
+		t.Fatalf("Max = %d, %d, %v", k, v, ok)
+	}
+	if k, _, _ := st.DeleteMin(); k != 0 {
+		t.Fatalf("DeleteMin = %d, want 0", k)
+	}
+	if k, _, _ := st.DeleteMax(); k != 9 {
+		t.Fatalf("DeleteMax = %d, want 9", k)
+	}
+	if n := st.DeleteRange(3, 6); n != 3 {
+		t.Fatalf("DeleteRange removed %d, want 3", n)
+	}
+	if got, want := collect(-1, st.Ascend), []int{1, 2, 6, 7, 8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+
+	if v, loaded := st.GetOrInsert(1, 100); !loaded || v != 10 {
+		t.Fatalf("GetOrInsert existing = %d, %v", v, loaded)
+	}
+	if v, loaded := st.GetOrInsert(20, 200); loaded || v != 200 {
+		t.Fatalf("GetOrInsert new = %d, %v", v, loaded)
+	}
+	incr := func(v int, _ bool) (int, bool) { return v + 1, true }
+	if v, ok := st.Update(20, incr); !ok || v != 201 {
+		t.Fatalf("Update existing = %d, %v", v, ok)
+	}
+	if _, ok := st.Update(20, func(v int, _ bool) (int, bool) { return v, false }); ok {
+		t.Fatalf("Update returning keep=false should delete")
+	}
+	if _, ok := st.Get(20); ok {
+		t.Fatalf("key 20 should be deleted")
+	}
+}
+
+func TestShardedDeleteMinQueue(t *testing.T) {
+	st := NewSharded[int, int](8, 4, intLess, HashShard[int](intHash))
+	for i := 0; i < 1000; i++ {
+		st.Insert(i, i)
+	}
+	// 多个消费者并发出队，每个元素恰好被取出一次
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[int]bool)
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				k, _, ok := st.DeleteMin()
+				if !ok {
+					return
+				}
+				mu.Lock()
+				if seen[k] {
+					t.Errorf("key %d popped twice", k)
+				}
+				seen[k] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 1000 || !st.IsEmpty() {
+		t.Fatalf("popped %d keys, remaining %d", len(seen), st.Size())
+	}
+}
+
+func TestShardedSaveLoad(t *testing.T) {
+	st := NewSharded[int, string](4, 4, intLess, HashShard[int](intHash))
+	bt := New[int, string](4, intLess)
+	for i := 0; i < 1000; i++ {
+		st.Insert(i, strconv.Itoa(i))
+		bt.Insert(i, strconv.Itoa(i))
+	}
+	// 分片的快照与 BTreeLock 的格式相同，可以互相加载
+	var sharded, plain bytes.Buffer
+	if err := st.Save(&sharded, IntCodec[int]{}, StringCodec{}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := bt.Save(&plain, IntCodec[int]{}, StringCodec{}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if !bytes.Equal(sharded.Bytes(), plain.Bytes()) {
+		t.Fatalf("sharded snapshot differs from BTreeLock snapshot")
+	}
+
+	dst := NewSharded[int, string](3, 4, intLess, RangeShard[int](intLess, 100, 500))
+	dst.Insert(-1, "stale")
+	if err := dst.Load(bytes.NewReader(plain.Bytes()), IntCodec[int]{}, StringCodec{}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if dst.Size() != 1000 {
+		t.Fatalf("size = %d, want 1000", dst.Size())
+	}
+	if _, ok := dst.Get(-1); ok {
+		t.Fatalf("Load must replace existing content")
+	}
+	if v, ok := dst.Get(999); !ok || v != "999" {
+		t.Fatalf("Get(999) = %q, %v", v, ok)
+	}
+	if err := dst.Load(bytes.NewReader(plain.Bytes()[:plain.Len()-1]), IntCodec[int]{}, StringCodec{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("Load of truncated snapshot = %v, want ErrInvalidSnapshot", err)
+	}
+	if dst.Size() != 1000 {
+		t.Fatalf("failed Load must not modify the tree")
+	}
+}
+
+func BenchmarkParallelInsert(b *testing.B) {
+	b.Run("BTreeLock", func(b *testing.B) {
+		bt := New[int, int](32, intLess)
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				bt.Insert(i, i)
+				i++
+			}
+		})
+	})
+	b.Run("ShardedBTree", func(b *testing.B) {
+		st := NewSharded[int, int](16, 32, intLess, HashShard[int](intHash))
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				st.Insert(i, i)
+				i++
+			}
+		})
+	})
+}
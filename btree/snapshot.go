@@ -0,0 +1,91 @@
+package btree
+
+import "iter"
+
+// Snapshot 是 BTreeLock 某一时刻的只读视图
+// 基于 google/btree 的写时复制 Clone 实现，创建快照是 O(1) 的，
+// 原树后续的写入只会复制被修改的节点，不会影响快照内容。
+// 快照的读取不需要加锁，可以与原树的写操作以及其他读者并发进行。
+type Snapshot[K comparable, V any] struct {
+	tree *BTree[K, V]
+}
+
+// Snapshot 创建当前时刻的只读快照，适合长时间的遍历，遍历期间不会阻塞写操作
+func (bt *BTreeLock[K, V]) Snapshot() *Snapshot[K, V] {
+	// Clone 会修改原树的写时复制标记，因此需要写锁
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+	return &Snapshot[K, V]{
+		tree: &BTree[K, V]{tree: bt.tree.Clone(), less: bt.less},
+	}
+}
+
+// Get 查找键对应的值
+func (s *Snapshot[K, V]) Get(key K) (V, bool) {
+	return s.tree.Get(key)
+}
+
+// Size 返回快照中的元素数量
+func (s *Snapshot[K, V]) Size() int {
+	return s.tree.Size()
+}
+
+// IsEmpty 判断快照是否为空
+func (s *Snapshot[K, V]) IsEmpty() bool {
+	return s.tree.IsEmpty()
+}
+
+// Ascend 按升序遍历所有元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) Ascend(fn func(K, V) bool) {
+	s.tree.Ascend(fn)
+}
+
+// AscendRange 按升序遍历半开区间 [start, end) 内的元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) AscendRange(start, end K, fn func(K, V) bool) {
+	s.tree.AscendRange(start, end, fn)
+}
+
+// AscendGreaterOrEqual 按升序遍历 [pivot, +∞) 内的元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) AscendGreaterOrEqual(pivot K, fn func(K, V) bool) {
+	s.tree.AscendGreaterOrEqual(pivot, fn)
+}
+
+// AscendLessThan 按升序遍历 (-∞, pivot) 内的元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) AscendLessThan(pivot K, fn func(K, V) bool) {
+	s.tree.AscendLessThan(pivot, fn)
+}
+
+// Descend 按降序遍历所有元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) Descend(fn func(K, V) bool) {
+	s.tree.Descend(fn)
+}
+
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即区间 (end, start]，fn 返回 false 时停止
+func (s *Snapshot[K, V]) DescendRange(start, end K, fn func(K, V) bool) {
+	s.tree.DescendRange(start, end, fn)
+}
+
+// DescendLessOrEqual 按降序遍历 (-∞, pivot] 内的元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) DescendLessOrEqual(pivot K, fn func(K, V) bool) {
+	s.tree.DescendLessOrEqual(pivot, fn)
+}
+
+// DescendGreaterThan 按降序遍历 (pivot, +∞) 内的元素，fn 返回 false 时停止
+func (s *Snapshot[K, V]) DescendGreaterThan(pivot K, fn func(K, V) bool) {
+	s.tree.DescendGreaterThan(pivot, fn)
+}
+
+// All 返回按升序遍历所有元素的迭代器
+func (s *Snapshot[K, V]) All() iter.Seq2[K, V] {
+	return s.tree.All()
+}
+
+// Backward 返回按降序遍历所有元素的迭代器
+func (s *Snapshot[K, V]) Backward() iter.Seq2[K, V] {
+	return s.tree.Backward()
+}
+
+// Range 返回按升序遍历半开区间 [start, end) 的迭代器
+func (s *Snapshot[K, V]) Range(start, end K) iter.Seq2[K, V] {
+	return s.tree.Range(start, end)
+}
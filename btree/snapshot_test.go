@@ -0,0 +1,49 @@
+package btree
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	bt := New[int, int](4, func(a, b int) bool {
+		return a < b
+	})
+	for i := 0; i < 1000; i++ {
+		bt.Insert(i, i)
+	}
+	snap := bt.Snapshot()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			bt.Delete(i)
+			bt.Insert(i+1000, i)
+		}
+	}()
+
+	// 快照遍历不持有锁，与写操作并发进行
+	count := 0
+	for k, v := range snap.All() {
+		if k != v {
+			t.Errorf("snapshot value of %d = %d", k, v)
+		}
+		count++
+	}
+	wg.Wait()
+
+	if count != 1000 || snap.Size() != 1000 {
+		t.Fatalf("snapshot saw %d items, size %d; want 1000", count, snap.Size())
+	}
+	if _, ok := snap.Get(1500); ok {
+		t.Fatalf("snapshot must not see writes made after it was taken")
+	}
+	if _, ok := bt.Get(0); ok {
+		t.Fatalf("original tree should have deleted key 0")
+	}
+	if v, ok := bt.Get(1500); !ok || v != 500 {
+		t.Fatalf("original Get(1500) = %d, %v", v, ok)
+	}
+}
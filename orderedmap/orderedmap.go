@@ -0,0 +1,43 @@
+// Package orderedmap 定义有序映射的公共接口，btree.BTree、btree.BTreeLock 和
+// redblacktree.RedBlackTree 都实现了该接口，可以按场景互相替换。
+//
+// 选型建议（参考本包的 BenchmarkOrderedMap）：
+//   - btree.BTree：单协程场景的默认选择，节点内元素连续存放，缓存友好，读写和遍历都最快。
+//   - btree.BTreeLock：多协程共享时使用，读多写少表现良好；长时间遍历请使用 Snapshot。
+//   - redblacktree.RedBlackTree：需要 Rank/Select、Floor/Ceiling 等顺序统计查询，
+//     或需要在其上扩展（如区间树）时使用，常数开销比 B 树大。
+//
+// 新的实现可以用 orderedmaptest 包中的一致性测试、模糊测试和基准测试进行验证。
+package orderedmap
+
+import "iter"
+
+// OrderedMap 按键有序的映射
+// 所有区间参数都采用半开语义：AscendRange/Range 遍历 [start, end)，
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即 (end, start]。
+type OrderedMap[K, V any] interface {
+	// Insert 插入键值对，键已存在时覆盖旧值
+	Insert(key K, value V)
+	// Get 查找键对应的值
+	Get(key K) (V, bool)
+	// Delete 删除指定键，键不存在时不做任何操作
+	Delete(key K)
+	// Size 返回元素数量
+	Size() int
+	// IsEmpty 判断是否为空
+	IsEmpty() bool
+	// Ascend 按升序遍历所有元素，fn 返回 false 时停止
+	Ascend(fn func(key K, value V) bool)
+	// AscendRange 按升序遍历 [start, end) 内的元素，fn 返回 false 时停止
+	AscendRange(start, end K, fn func(key K, value V) bool)
+	// Descend 按降序遍历所有元素，fn 返回 false 时停止
+	Descend(fn func(key K, value V) bool)
+	// DescendRange 按降序遍历 (end, start] 内的元素，fn 返回 false 时停止
+	DescendRange(start, end K, fn func(key K, value V) bool)
+	// All 返回按升序遍历所有元素的迭代器
+	All() iter.Seq2[K, V]
+	// Backward 返回按降序遍历所有元素的迭代器
+	Backward() iter.Seq2[K, V]
+	// Range 返回按升序遍历 [start, end) 的迭代器
+	Range(start, end K) iter.Seq2[K, V]
+}
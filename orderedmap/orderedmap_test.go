@@ -0,0 +1,34 @@
+package orderedmap_test
+
+import (
+	"cmp"
+	"testing"
+
+	"github.com/lwm-galactic/tools/btree"
+	"github.com/lwm-galactic/tools/orderedmap"
+	"github.com/lwm-galactic/tools/orderedmap/orderedmaptest"
+	"github.com/lwm-galactic/tools/redblacktree"
+)
+
+func intLess(a, b int) bool {
+	return a < b
+}
+
+// BenchmarkOrderedMap 对比各实现在相同负载下的表现
+func BenchmarkOrderedMap(b *testing.B) {
+	impls := []struct {
+		name   string
+		newMap orderedmaptest.Factory
+	}{
+		{"BTree", func() orderedmap.OrderedMap[int, int] { return btree.NewNoLock[int, int](32, intLess) }},
+		{"BTreeLock", func() orderedmap.OrderedMap[int, int] { return btree.New[int, int](32, intLess) }},
+		{"RedBlackTree", func() orderedmap.OrderedMap[int, int] {
+			return redblacktree.NewRedBlackTree[int, int](cmp.Compare[int])
+		}},
+	}
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			orderedmaptest.Benchmark(b, impl.newMap, 100000)
+		})
+	}
+}
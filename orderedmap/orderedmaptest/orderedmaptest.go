@@ -0,0 +1,273 @@
+// Package orderedmaptest 提供 orderedmap.OrderedMap 实现共用的一致性测试、模糊测试和基准测试。
+//
+// 在实现所在包的测试文件中调用即可：
+//
+//	func TestOrderedMap(t *testing.T) {
+//		orderedmaptest.Run(t, func() orderedmap.OrderedMap[int, int] { return NewMyMap[int, int]() })
+//	}
+package orderedmaptest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/lwm-galactic/tools/orderedmap"
+)
+
+// Factory 创建一个空的、键和值都为 int 的有序映射
+type Factory func() orderedmap.OrderedMap[int, int]
+
+// Run 运行一致性测试
+func Run(t *testing.T, newMap Factory) {
+	t.Run("Empty", func(t *testing.T) {
+		m := newMap()
+		if !m.IsEmpty() || m.Size() != 0 {
+			t.Fatalf("new map is not empty")
+		}
+		if _, ok := m.Get(1); ok {
+			t.Fatalf("Get on empty map should fail")
+		}
+		m.Delete(1)
+		Verify(t, m, map[int]int{})
+	})
+
+	t.Run("InsertGetDelete", func(t *testing.T) {
+		m := newMap()
+		model := map[int]int{}
+		for _, k := range []int{5, 3, 8, 1, 4, 7, 9} {
+			m.Insert(k, k*10)
+			model[k] = k * 10
+		}
+		Verify(t, m, model)
+
+		m.Insert(5, 55)
+		model[5] = 55
+		m.Delete(3)
+		delete(model, 3)
+		m.Delete(100)
+		Verify(t, m, model)
+	})
+
+	t.Run("EarlyStop", func(t *testing.T) {
+		m := newMap()
+		for i := 0; i < 10; i++ {
+			m.Insert(i, i)
+		}
+		if got := collect(m.Ascend, 3); fmt.Sprint(got) != "[0 1 2]" {
+			t.Errorf("Ascend with early stop = %v", got)
+		}
+		if got := collect(m.Descend, 3); fmt.Sprint(got) != "[9 8 7]" {
+			t.Errorf("Descend with early stop = %v", got)
+		}
+		var keys []int
+		for k := range m.All() {
+			if k == 3 {
+				break
+			}
+			keys = append(keys, k)
+		}
+		if fmt.Sprint(keys) != "[0 1 2]" {
+			t.Errorf("All with break = %v", keys)
+		}
+	})
+
+	t.Run("RangeBounds", func(t *testing.T) {
+		m := newMap()
+		for i := 0; i < 10; i += 2 {
+			m.Insert(i, i)
+		}
+		cases := []struct {
+			name string
+			walk func(fn func(int, int) bool)
+			want string
+		}{
+			{"AscendRange [2, 6)", func(fn func(int, int) bool) { m.AscendRange(2, 6, fn) }, "[2 4]"},
+			{"AscendRange [3, 7)", func(fn func(int, int) bool) { m.AscendRange(3, 7, fn) }, "[4 6]"},
+			{"AscendRange [4, 4)", func(fn func(int, int) bool) { m.AscendRange(4, 4, fn) }, "[]"},
+			{"DescendRange (2, 6]", func(fn func(int, int) bool) { m.DescendRange(6, 2, fn) }, "[6 4]"},
+			{"DescendRange (3, 7]", func(fn func(int, int) bool) { m.DescendRange(7, 3, fn) }, "[6 4]"},
+		}
+		for _, c := range cases {
+			if got := collect(c.walk, 0); fmt.Sprint(got) != c.want {
+				t.Errorf("%s = %v, want %s", c.name, got, c.want)
+			}
+		}
+	})
+
+	t.Run("RandomOps", func(t *testing.T) {
+		m := newMap()
+		model := map[int]int{}
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 5000; i++ {
+			k := rnd.Intn(1000)
+			switch rnd.Intn(3) {
+			case 0:
+				m.Delete(k)
+				delete(model, k)
+			default:
+				m.Insert(k, i)
+				model[k] = i
+			}
+		}
+		Verify(t, m, model)
+	})
+}
+
+// Fuzz 以字节序列描述的操作驱动模糊测试：每两个字节为一次操作，
+// 第一个字节选择插入/删除/查找，第二个字节为键
+func Fuzz(f *testing.F, newMap Factory) {
+	f.Add([]byte{0, 1, 0, 2, 1, 1, 2, 2})
+	f.Add([]byte{0, 10, 0, 5, 0, 20, 1, 10, 0, 10})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		m := newMap()
+		model := map[int]int{}
+		for i := 0; i+1 < len(ops); i += 2 {
+			key := int(ops[i+1])
+			switch ops[i] % 3 {
+			case 0:
+				m.Insert(key, i)
+				model[key] = i
+			case 1:
+				m.Delete(key)
+				delete(model, key)
+			default:
+				got, ok := m.Get(key)
+				want, wantOK := model[key]
+				if ok != wantOK || got != want {
+					t.Fatalf("Get(%d) = %d, %v; want %d, %v", key, got, ok, want, wantOK)
+				}
+			}
+		}
+		Verify(t, m, model)
+	})
+}
+
+// Verify 校验 m 的内容与 model 一致，并且所有遍历方法的顺序和区间语义正确
+func Verify(t testing.TB, m orderedmap.OrderedMap[int, int], model map[int]int) {
+	t.Helper()
+	keys := make([]int, 0, len(model))
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	if m.Size() != len(model) || m.IsEmpty() != (len(model) == 0) {
+		t.Fatalf("Size = %d, IsEmpty = %v; want %d", m.Size(), m.IsEmpty(), len(model))
+	}
+	for k, want := range model {
+		if got, ok := m.Get(k); !ok || got != want {
+			t.Fatalf("Get(%d) = %d, %v; want %d", k, got, ok, want)
+		}
+	}
+
+	check := func(name string, got, want []int) {
+		t.Helper()
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%s = %v, want %v", name, got, want)
+		}
+	}
+	reversed := make([]int, len(keys))
+	for i, k := range keys {
+		reversed[len(keys)-1-i] = k
+	}
+	check("Ascend", collect(m.Ascend, 0), keys)
+	check("Descend", collect(m.Descend, 0), reversed)
+	check("All", collectSeq(m.All()), keys)
+	check("Backward", collectSeq(m.Backward()), reversed)
+
+	if len(keys) == 0 {
+		return
+	}
+	// 以中间的键为界检查半开区间语义
+	lo, hi := keys[len(keys)/4], keys[len(keys)*3/4]
+	var ascWant, descWant []int
+	for _, k := range keys {
+		if k >= lo && k < hi {
+			ascWant = append(ascWant, k)
+		}
+	}
+	for _, k := range reversed {
+		if k <= hi && k > lo {
+			descWant = append(descWant, k)
+		}
+	}
+	check("AscendRange", collect(func(fn func(int, int) bool) { m.AscendRange(lo, hi, fn) }, 0), ascWant)
+	check("Range", collectSeq(m.Range(lo, hi)), ascWant)
+	check("DescendRange", collect(func(fn func(int, int) bool) { m.DescendRange(hi, lo, fn) }, 0), descWant)
+}
+
+// Benchmark 运行基准测试，n 为预先插入的元素数量
+func Benchmark(b *testing.B, newMap Factory, n int) {
+	keys := rand.New(rand.NewSource(1)).Perm(n)
+	filled := func() orderedmap.OrderedMap[int, int] {
+		m := newMap()
+		for _, k := range keys {
+			m.Insert(k, k)
+		}
+		return m
+	}
+
+	b.Run("Insert", func(b *testing.B) {
+		b.ReportAllocs()
+		m := newMap()
+		for i := 0; i < b.N; i++ {
+			k := keys[i%n]
+			m.Insert(k, k)
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		m := filled()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Get(keys[i%n])
+		}
+	})
+	b.Run("DeleteInsert", func(b *testing.B) {
+		m := filled()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := keys[i%n]
+			m.Delete(k)
+			m.Insert(k, k)
+		}
+	})
+	b.Run("Ascend", func(b *testing.B) {
+		m := filled()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Ascend(func(int, int) bool { return true })
+		}
+	})
+	b.Run("Range100", func(b *testing.B) {
+		m := filled()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			start := keys[i%n]
+			m.AscendRange(start, start+100, func(int, int) bool { return true })
+		}
+	})
+}
+
+// collect 收集遍历结果，最多 limit 个（limit <= 0 表示不限制）
+func collect(walk func(fn func(int, int) bool), limit int) []int {
+	keys := []int{}
+	walk(func(k, _ int) bool {
+		keys = append(keys, k)
+		return limit <= 0 || len(keys) < limit
+	})
+	return keys
+}
+
+func collectSeq(seq func(yield func(int, int) bool)) []int {
+	keys := []int{}
+	for k := range seq {
+		keys = append(keys, k)
+	}
+	return keys
+}
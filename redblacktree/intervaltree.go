@@ -0,0 +1,126 @@
+package redblacktree
+
+// Interval 闭区间 [Low, High]
+// Low 大于 High 的区间在插入、查找、删除和查询时都会交换两个端点，视为 [High, Low]
+type Interval[T any] struct {
+	Low  T
+	High T
+}
+
+// IntervalEntry 区间查询的结果
+type IntervalEntry[T, V any] struct {
+	Interval Interval[T]
+	Value    V
+}
+
+// intervalKey 区间树内部使用的键，max 为以该节点为根的子树中最大的右端点
+type intervalKey[T any] struct {
+	Interval[T]
+	max T
+}
+
+// IntervalTree 基于红黑树的区间树，每个节点额外维护子树的最大右端点，
+// 区间查询可以剪掉不可能重叠的子树，复杂度为 O(log n + k)
+type IntervalTree[T, V any] struct {
+	tree       *RedBlackTree[intervalKey[T], V]
+	comparator func(a, b T) int
+}
+
+// NewIntervalTree 创建新的区间树 需要传入端点的比较函数
+func NewIntervalTree[T, V any](comparator func(a, b T) int) *IntervalTree[T, V] {
+	it := &IntervalTree[T, V]{comparator: comparator}
+	// 区间按 (Low, High) 排序，Low 和 High 都相同的区间视为同一个键
+	it.tree = NewRedBlackTree[intervalKey[T], V](func(a, b intervalKey[T]) int {
+		if cmp := comparator(a.Low, b.Low); cmp != 0 {
+			return cmp
+		}
+		return comparator(a.High, b.High)
+	})
+	it.tree.augment = it.augment
+	return it
+}
+
+// augment 重新计算节点子树的最大右端点
+func (it *IntervalTree[T, V]) augment(node *Node[intervalKey[T], V]) {
+	node.Key.max = node.Key.High
+	if node.Left != it.tree.nilNode && it.comparator(node.Left.Key.max, node.Key.max) > 0 {
+		node.Key.max = node.Left.Key.max
+	}
+	if node.Right != it.tree.nilNode && it.comparator(node.Right.Key.max, node.Key.max) > 0 {
+		node.Key.max = node.Right.Key.max
+	}
+}
+
+// normalize 端点顺序相反时交换
+func (it *IntervalTree[T, V]) normalize(interval Interval[T]) Interval[T] {
+	if it.comparator(interval.Low, interval.High) > 0 {
+		interval.Low, interval.High = interval.High, interval.Low
+	}
+	return interval
+}
+
+// Insert 插入区间及其对应的值，相同区间已存在时覆盖旧值
+func (it *IntervalTree[T, V]) Insert(interval Interval[T], value V) {
+	interval = it.normalize(interval)
+	it.tree.Insert(intervalKey[T]{Interval: interval, max: interval.High}, value)
+}
+
+// Get 查找与给定区间完全相同的区间对应的值
+func (it *IntervalTree[T, V]) Get(interval Interval[T]) (V, bool) {
+	return it.tree.Get(intervalKey[T]{Interval: it.normalize(interval)})
+}
+
+// Delete 删除与给定区间完全相同的区间
+func (it *IntervalTree[T, V]) Delete(interval Interval[T]) {
+	it.tree.Delete(intervalKey[T]{Interval: it.normalize(interval)})
+}
+
+// Size 返回区间数量
+func (it *IntervalTree[T, V]) Size() int {
+	return it.tree.Size()
+}
+
+// IsEmpty 判断是否为空
+func (it *IntervalTree[T, V]) IsEmpty() bool {
+	return it.tree.IsEmpty()
+}
+
+// Overlapping 返回所有与 q 重叠的区间（端点相接也视为重叠），按 (Low, High) 升序排列
+func (it *IntervalTree[T, V]) Overlapping(q Interval[T]) []IntervalEntry[T, V] {
+	var result []IntervalEntry[T, V]
+	it.overlapping(it.tree.Root, it.normalize(q), &result)
+	return result
+}
+
+// Stabbing 返回所有包含 point 的区间，按 (Low, High) 升序排列
+func (it *IntervalTree[T, V]) Stabbing(point T) []IntervalEntry[T, V] {
+	return it.Overlapping(Interval[T]{Low: point, High: point})
+}
+
+// Ascend 按 (Low, High) 升序遍历所有区间，fn 返回 false 时停止
+func (it *IntervalTree[T, V]) Ascend(fn func(interval Interval[T], value V) bool) {
+	it.tree.Ascend(func(key intervalKey[T], value V) bool {
+		return fn(key.Interval, value)
+	})
+}
+
+func (it *IntervalTree[T, V]) overlapping(node *Node[intervalKey[T], V], q Interval[T], result *[]IntervalEntry[T, V]) {
+	if node == it.tree.nilNode {
+		return
+	}
+	// 左子树的最大右端点小于 q.Low 时，左子树中不可能有重叠区间
+	if node.Left != it.tree.nilNode && it.comparator(node.Left.Key.max, q.Low) >= 0 {
+		it.overlapping(node.Left, q, result)
+	}
+	if it.overlaps(node.Key.Interval, q) {
+		*result = append(*result, IntervalEntry[T, V]{Interval: node.Key.Interval, Value: node.Value})
+	}
+	// 右子树所有区间的左端点都不小于当前节点，当前左端点已大于 q.High 时无需继续
+	if it.comparator(node.Key.Low, q.High) <= 0 {
+		it.overlapping(node.Right, q, result)
+	}
+}
+
+func (it *IntervalTree[T, V]) overlaps(a, b Interval[T]) bool {
+	return it.comparator(a.Low, b.High) <= 0 && it.comparator(b.Low, a.High) <= 0
+}
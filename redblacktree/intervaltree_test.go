@@ -0,0 +1,123 @@
+package redblacktree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// checkMax 校验每个节点的最大右端点
+func checkMax(t *testing.T, it *IntervalTree[int, int]) {
+	t.Helper()
+	var walk func(n *Node[intervalKey[int], int]) int
+	walk = func(n *Node[intervalKey[int], int]) int {
+		if n == it.tree.nilNode {
+			return -1 << 31
+		}
+		want := max(n.Key.High, walk(n.Left), walk(n.Right))
+		if n.Key.max != want {
+			t.Fatalf("max mismatch at %v: %d != %d", n.Key.Interval, n.Key.max, want)
+		}
+		return want
+	}
+	walk(it.tree.Root)
+}
+
+func TestIntervalTree(t *testing.T) {
+	it := NewIntervalTree[int, int](intComparator)
+	rnd := rand.New(rand.NewSource(3))
+	expected := map[Interval[int]]int{}
+
+	for i := 0; i < 1500; i++ {
+		low := rnd.Intn(1000)
+		iv := Interval[int]{Low: low, High: low + rnd.Intn(50)}
+		if rnd.Intn(4) == 0 && len(expected) > 0 {
+			for k := range expected {
+				iv = k
+				break
+			}
+			it.Delete(iv)
+			delete(expected, iv)
+		} else {
+			it.Insert(iv, i)
+			expected[iv] = i
+		}
+		checkInvariants(t, it.tree)
+		checkMax(t, it)
+	}
+	if it.Size() != len(expected) {
+		t.Fatalf("size = %d, want %d", it.Size(), len(expected))
+	}
+
+	for i := 0; i < 200; i++ {
+		low := rnd.Intn(1100) - 50
+		q := Interval[int]{Low: low, High: low + rnd.Intn(30)}
+		got := it.Overlapping(q)
+
+		want := 0
+		for iv, v := range expected {
+			if iv.Low <= q.High && q.Low <= iv.High {
+				want++
+				if val, ok := it.Get(iv); !ok || val != v {
+					t.Fatalf("Get(%v) = %v, %v; want %d", iv, val, ok, v)
+				}
+			}
+		}
+		if len(got) != want {
+			t.Fatalf("Overlapping(%v) returned %d intervals, want %d", q, len(got), want)
+		}
+		for j, e := range got {
+			if e.Interval.Low > q.High || q.Low > e.Interval.High {
+				t.Fatalf("Overlapping(%v) returned non-overlapping %v", q, e.Interval)
+			}
+			if e.Value != expected[e.Interval] {
+				t.Fatalf("wrong value for %v", e.Interval)
+			}
+			if j > 0 && intComparator(got[j-1].Interval.Low, e.Interval.Low) > 0 {
+				t.Fatalf("Overlapping result not sorted")
+			}
+		}
+	}
+}
+
+func TestIntervalTreeStabbing(t *testing.T) {
+	it := NewIntervalTree[int, string](intComparator)
+	it.Insert(Interval[int]{Low: 1, High: 5}, "a")
+	it.Insert(Interval[int]{Low: 3, High: 8}, "b")
+	it.Insert(Interval[int]{Low: 10, High: 12}, "c")
+
+	cases := map[int][]string{
+		0:  nil,
+		1:  {"a"},
+		5:  {"a", "b"},
+		8:  {"b"},
+		9:  nil,
+		12: {"c"},
+	}
+	for point, want := range cases {
+		got := it.Stabbing(point)
+		if len(got) != len(want) {
+			t.Fatalf("Stabbing(%d) = %v, want %v", point, got, want)
+		}
+		for i := range got {
+			if got[i].Value != want[i] {
+				t.Fatalf("Stabbing(%d) = %v, want %v", point, got, want)
+			}
+		}
+	}
+}
+
+func TestIntervalTreeReversedBounds(t *testing.T) {
+	it := NewIntervalTree[int, string](intComparator)
+	// 端点顺序相反的区间按 [High, Low] 处理
+	it.Insert(Interval[int]{Low: 8, High: 3}, "a")
+	if v, ok := it.Get(Interval[int]{Low: 3, High: 8}); !ok || v != "a" {
+		t.Fatalf("Get = %q, %v", v, ok)
+	}
+	if got := it.Overlapping(Interval[int]{Low: 10, High: 5}); len(got) != 1 || got[0].Interval != (Interval[int]{Low: 3, High: 8}) {
+		t.Fatalf("Overlapping = %v", got)
+	}
+	it.Delete(Interval[int]{Low: 8, High: 3})
+	if !it.IsEmpty() {
+		t.Fatalf("Delete with reversed bounds should remove the interval")
+	}
+}
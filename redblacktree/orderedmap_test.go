@@ -0,0 +1,22 @@
+package redblacktree
+
+import (
+	"testing"
+
+	"github.com/lwm-galactic/tools/orderedmap"
+	"github.com/lwm-galactic/tools/orderedmap/orderedmaptest"
+)
+
+var _ orderedmap.OrderedMap[int, int] = (*RedBlackTree[int, int])(nil)
+
+func newRedBlackTree() orderedmap.OrderedMap[int, int] {
+	return NewRedBlackTree[int, int](intComparator)
+}
+
+func TestRedBlackTreeOrderedMap(t *testing.T) {
+	orderedmaptest.Run(t, newRedBlackTree)
+}
+
+func FuzzRedBlackTree(f *testing.F) {
+	orderedmaptest.Fuzz(f, newRedBlackTree)
+}
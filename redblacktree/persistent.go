@@ -0,0 +1,273 @@
+package redblacktree
+
+// PersistentRedBlackTree 持久化（不可变）红黑树
+// 基于左倾红黑树（LLRB）实现，Insert/Delete 只复制从根到目标节点路径上的 O(log n) 个节点，
+// 返回的新版本与旧版本共享其余结构。任何版本一经创建就不会再被修改，
+// 因此读者持有某个版本即可在无锁的情况下并发读取，写者继续生成新版本。
+// 多个写者之间仍需自行同步，常见做法是用 atomic.Pointer 发布最新版本。
+type PersistentRedBlackTree[K, V any] struct {
+	root       *persistentNode[K, V]
+	comparator func(a, b K) int
+}
+
+// persistentNode 持久化红黑树的节点，挂到某个版本上之后不再修改
+type persistentNode[K, V any] struct {
+	key   K
+	value V
+	left  *persistentNode[K, V]
+	right *persistentNode[K, V]
+	color Color
+	size  int
+}
+
+// NewPersistentRedBlackTree 创建一个空的持久化红黑树 自定义key 结构 和 比较函数
+func NewPersistentRedBlackTree[K, V any](comparator func(a, b K) int) *PersistentRedBlackTree[K, V] {
+	return &PersistentRedBlackTree[K, V]{comparator: comparator}
+}
+
+// Size 返回当前版本的元素数量
+func (tree *PersistentRedBlackTree[K, V]) Size() int {
+	return nodeSize(tree.root)
+}
+
+// IsEmpty 判断当前版本是否为空
+func (tree *PersistentRedBlackTree[K, V]) IsEmpty() bool {
+	return tree.root == nil
+}
+
+// Get 查找键对应的值
+func (tree *PersistentRedBlackTree[K, V]) Get(key K) (V, bool) {
+	node := tree.search(key)
+	if node == nil {
+		var value V
+		return value, false
+	}
+	return node.value, true
+}
+
+// Insert 插入键值对并返回新版本，键已存在时新版本中覆盖旧值，原版本保持不变
+func (tree *PersistentRedBlackTree[K, V]) Insert(key K, value V) *PersistentRedBlackTree[K, V] {
+	root := tree.insert(tree.root, key, value)
+	root.color = Black
+	return &PersistentRedBlackTree[K, V]{root: root, comparator: tree.comparator}
+}
+
+// Delete 删除指定键并返回新版本，键不存在时直接返回当前版本
+func (tree *PersistentRedBlackTree[K, V]) Delete(key K) *PersistentRedBlackTree[K, V] {
+	if tree.search(key) == nil {
+		return tree
+	}
+	root := tree.root.clone()
+	if !isRed(root.left) && !isRed(root.right) {
+		root.color = Red
+	}
+	root = tree.delete(root, key)
+	if root != nil {
+		root.color = Black
+	}
+	return &PersistentRedBlackTree[K, V]{root: root, comparator: tree.comparator}
+}
+
+// Min 返回最小的键值对
+func (tree *PersistentRedBlackTree[K, V]) Min() (K, V, bool) {
+	if tree.root == nil {
+		var (
+			key   K
+			value V
+		)
+		return key, value, false
+	}
+	node := tree.root
+	for node.left != nil {
+		node = node.left
+	}
+	return node.key, node.value, true
+}
+
+// Max 返回最大的键值对
+func (tree *PersistentRedBlackTree[K, V]) Max() (K, V, bool) {
+	if tree.root == nil {
+		var (
+			key   K
+			value V
+		)
+		return key, value, false
+	}
+	node := tree.root
+	for node.right != nil {
+		node = node.right
+	}
+	return node.key, node.value, true
+}
+
+// Ascend 按升序遍历当前版本的所有元素，fn 返回 false 时停止
+func (tree *PersistentRedBlackTree[K, V]) Ascend(fn func(key K, value V) bool) {
+	var walk func(n *persistentNode[K, V]) bool
+	walk = func(n *persistentNode[K, V]) bool {
+		if n == nil {
+			return true
+		}
+		return walk(n.left) && fn(n.key, n.value) && walk(n.right)
+	}
+	walk(tree.root)
+}
+
+func (tree *PersistentRedBlackTree[K, V]) search(key K) *persistentNode[K, V] {
+	cur := tree.root
+	for cur != nil {
+		cmp := tree.comparator(key, cur.key)
+		switch {
+		case cmp < 0:
+			cur = cur.left
+		case cmp > 0:
+			cur = cur.right
+		default:
+			return cur
+		}
+	}
+	return nil
+}
+
+// 以下辅助函数约定：传入的 h 已经是当前版本私有的副本，可以直接修改；
+// 其子节点仍可能被其他版本共享，修改前必须先 clone。
+
+func (tree *PersistentRedBlackTree[K, V]) insert(h *persistentNode[K, V], key K, value V) *persistentNode[K, V] {
+	if h == nil {
+		return &persistentNode[K, V]{key: key, value: value, color: Red, size: 1}
+	}
+	h = h.clone()
+	cmp := tree.comparator(key, h.key)
+	switch {
+	case cmp < 0:
+		h.left = tree.insert(h.left, key, value)
+	case cmp > 0:
+		h.right = tree.insert(h.right, key, value)
+	default:
+		h.value = value
+	}
+	return balance(h)
+}
+
+// delete 调用方保证 key 存在于以 h 为根的子树中
+func (tree *PersistentRedBlackTree[K, V]) delete(h *persistentNode[K, V], key K) *persistentNode[K, V] {
+	if tree.comparator(key, h.key) < 0 {
+		if !isRed(h.left) && !isRed(h.left.left) {
+			h = moveRedLeft(h)
+		}
+		h.left = tree.delete(h.left.clone(), key)
+		return balance(h)
+	}
+
+	if isRed(h.left) {
+		h = rotateRight(h)
+	}
+	if tree.comparator(key, h.key) == 0 && h.right == nil {
+		return nil
+	}
+	if !isRed(h.right) && !isRed(h.right.left) {
+		h = moveRedRight(h)
+	}
+	if tree.comparator(key, h.key) == 0 {
+		m := h.right
+		for m.left != nil {
+			m = m.left
+		}
+		h.key, h.value = m.key, m.value
+		h.right = deleteMin(h.right.clone())
+	} else {
+		h.right = tree.delete(h.right.clone(), key)
+	}
+	return balance(h)
+}
+
+func deleteMin[K, V any](h *persistentNode[K, V]) *persistentNode[K, V] {
+	if h.left == nil {
+		return nil
+	}
+	if !isRed(h.left) && !isRed(h.left.left) {
+		h = moveRedLeft(h)
+	}
+	h.left = deleteMin(h.left.clone())
+	return balance(h)
+}
+
+func (n *persistentNode[K, V]) clone() *persistentNode[K, V] {
+	c := *n
+	return &c
+}
+
+func isRed[K, V any](n *persistentNode[K, V]) bool {
+	return n != nil && n.color == Red
+}
+
+func nodeSize[K, V any](n *persistentNode[K, V]) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func rotateLeft[K, V any](h *persistentNode[K, V]) *persistentNode[K, V] {
+	x := h.right.clone()
+	h.right = x.left
+	x.left = h
+	x.color = h.color
+	h.color = Red
+	x.size = h.size
+	h.size = nodeSize(h.left) + nodeSize(h.right) + 1
+	return x
+}
+
+func rotateRight[K, V any](h *persistentNode[K, V]) *persistentNode[K, V] {
+	x := h.left.clone()
+	h.left = x.right
+	x.right = h
+	x.color = h.color
+	h.color = Red
+	x.size = h.size
+	h.size = nodeSize(h.left) + nodeSize(h.right) + 1
+	return x
+}
+
+// flipColors 翻转节点及其两个子节点的颜色，子节点先复制再修改
+func flipColors[K, V any](h *persistentNode[K, V]) {
+	h.color = !h.color
+	h.left = h.left.clone()
+	h.left.color = !h.left.color
+	h.right = h.right.clone()
+	h.right.color = !h.right.color
+}
+
+func moveRedLeft[K, V any](h *persistentNode[K, V]) *persistentNode[K, V] {
+	flipColors(h)
+	if isRed(h.right.left) {
+		h.right = rotateRight(h.right)
+		h = rotateLeft(h)
+		flipColors(h)
+	}
+	return h
+}
+
+func moveRedRight[K, V any](h *persistentNode[K, V]) *persistentNode[K, V] {
+	flipColors(h)
+	if isRed(h.left.left) {
+		h = rotateRight(h)
+		flipColors(h)
+	}
+	return h
+}
+
+// balance 恢复左倾红黑树性质并更新子树大小
+func balance[K, V any](h *persistentNode[K, V]) *persistentNode[K, V] {
+	if isRed(h.right) && !isRed(h.left) {
+		h = rotateLeft(h)
+	}
+	if isRed(h.left) && isRed(h.left.left) {
+		h = rotateRight(h)
+	}
+	if isRed(h.left) && isRed(h.right) {
+		flipColors(h)
+	}
+	h.size = nodeSize(h.left) + nodeSize(h.right) + 1
+	return h
+}
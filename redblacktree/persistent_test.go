@@ -0,0 +1,143 @@
+package redblacktree
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// checkLLRB 校验左倾红黑树性质和子树大小
+func checkLLRB(t *testing.T, tree *PersistentRedBlackTree[int, int]) {
+	t.Helper()
+	if isRed(tree.root) {
+		t.Fatalf("root must be black")
+	}
+	var walk func(n *persistentNode[int, int]) int
+	walk = func(n *persistentNode[int, int]) int {
+		if n == nil {
+			return 1
+		}
+		if isRed(n.right) {
+			t.Fatalf("right-leaning red link at %d", n.key)
+		}
+		if isRed(n) && isRed(n.left) {
+			t.Fatalf("two consecutive red links at %d", n.key)
+		}
+		if n.left != nil && n.left.key >= n.key || n.right != nil && n.right.key <= n.key {
+			t.Fatalf("order violated at %d", n.key)
+		}
+		lh, rh := walk(n.left), walk(n.right)
+		if lh != rh {
+			t.Fatalf("black height mismatch at %d", n.key)
+		}
+		if n.size != nodeSize(n.left)+nodeSize(n.right)+1 {
+			t.Fatalf("size mismatch at %d", n.key)
+		}
+		if isRed(n) {
+			return lh
+		}
+		return lh + 1
+	}
+	walk(tree.root)
+}
+
+func snapshotKeys(tree *PersistentRedBlackTree[int, int]) []int {
+	var keys []int
+	tree.Ascend(func(k int, _ int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+func TestPersistentVersions(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	versions := []*PersistentRedBlackTree[int, int]{NewPersistentRedBlackTree[int, int](intComparator)}
+	models := []map[int]int{{}}
+
+	for i := 0; i < 1000; i++ {
+		prev := versions[len(versions)-1]
+		model := make(map[int]int, len(models[len(models)-1]))
+		for k, v := range models[len(models)-1] {
+			model[k] = v
+		}
+		k := rnd.Intn(300)
+		var next *PersistentRedBlackTree[int, int]
+		if rnd.Intn(3) == 0 {
+			next = prev.Delete(k)
+			delete(model, k)
+		} else {
+			next = prev.Insert(k, i)
+			model[k] = i
+		}
+		checkLLRB(t, next)
+		versions = append(versions, next)
+		models = append(models, model)
+	}
+
+	// 所有历史版本都必须保持创建时的内容
+	for i, v := range versions {
+		if v.Size() != len(models[i]) {
+			t.Fatalf("version %d size = %d, want %d", i, v.Size(), len(models[i]))
+		}
+		for k, want := range models[i] {
+			got, ok := v.Get(k)
+			if !ok || got != want {
+				t.Fatalf("version %d Get(%d) = %v, %v; want %d", i, k, got, ok, want)
+			}
+		}
+	}
+}
+
+func TestPersistentMinMax(t *testing.T) {
+	empty := NewPersistentRedBlackTree[int, string](intComparator)
+	if _, _, ok := empty.Min(); ok {
+		t.Fatalf("Min on empty tree should fail")
+	}
+	tree := empty.Insert(3, "c").Insert(1, "a").Insert(2, "b")
+	if k, v, _ := tree.Min(); k != 1 || v != "a" {
+		t.Fatalf("Min = %d, %v", k, v)
+	}
+	if k, v, _ := tree.Max(); k != 3 || v != "c" {
+		t.Fatalf("Max = %d, %v", k, v)
+	}
+	if tree.Delete(42) != tree {
+		t.Fatalf("deleting an absent key should return the same version")
+	}
+	if !empty.IsEmpty() {
+		t.Fatalf("original version must stay empty")
+	}
+}
+
+func TestPersistentConcurrentReaders(t *testing.T) {
+	tree := NewPersistentRedBlackTree[int, int](intComparator)
+	for i := 0; i < 100; i++ {
+		tree = tree.Insert(i, i)
+	}
+	snapshot := tree
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if keys := snapshotKeys(snapshot); len(keys) != 100 {
+					t.Errorf("snapshot changed: %d keys", len(keys))
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		tree = tree.Delete(i).Insert(i+100, i)
+	}
+	wg.Wait()
+
+	if tree.Size() != 100 {
+		t.Fatalf("size = %d, want 100", tree.Size())
+	}
+	if _, ok := tree.Get(0); ok {
+		t.Fatalf("key 0 should be deleted in the latest version")
+	}
+}
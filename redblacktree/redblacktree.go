@@ -1,5 +1,7 @@
 package redblacktree
 
+import "iter"
+
 // ✅ 红黑树定义特性（回顾）
 // 红黑树满足以下 5 条规则：
 // 每个节点要么是红色，要么是黑色。
@@ -17,49 +19,558 @@ const (
 )
 
 // Node 节点结构体
-type Node[T any] struct {
-	Key    T
-	Value  interface{}
-	Left   *Node[T]
-	Right  *Node[T]
-	Parent *Node[T]
+type Node[K, V any] struct {
+	Key    K
+	Value  V
+	Left   *Node[K, V]
+	Right  *Node[K, V]
+	Parent *Node[K, V]
 	Color  Color
+	size   int // 以该节点为根的子树节点数，用于顺序统计
 }
 
 // RedBlackTree 红黑树结构体（带比较器）
-type RedBlackTree[T any] struct {
-	Root       *Node[T]
-	nilNode    *Node[T]
-	Comparator func(a, b T) int
+type RedBlackTree[K, V any] struct {
+	Root       *Node[K, V]
+	nilNode    *Node[K, V]
+	Comparator func(a, b K) int
+	augment    func(node *Node[K, V]) // 节点子树变化后维护附加信息，用于区间树等扩展结构
 }
 
 // NewRedBlackTree 创建新的红黑树 自定义key 结构 和 比较函数
-func NewRedBlackTree[T any](comparator func(a, b T) int) *RedBlackTree[T] {
-	nilNode := &Node[T]{
+func NewRedBlackTree[K, V any](comparator func(a, b K) int) *RedBlackTree[K, V] {
+	nilNode := &Node[K, V]{
 		Color: Black,
 	}
-	return &RedBlackTree[T]{
+	nilNode.Left, nilNode.Right, nilNode.Parent = nilNode, nilNode, nilNode
+	return &RedBlackTree[K, V]{
+		Root:       nilNode,
 		nilNode:    nilNode,
 		Comparator: comparator,
 	}
 }
 
 // 新建一个空节点
-func (tree *RedBlackTree[T]) newNode(key T, value interface{}) *Node[T] {
-	return &Node[T]{
+func (tree *RedBlackTree[K, V]) newNode(key K, value V) *Node[K, V] {
+	return &Node[K, V]{
 		Key:    key,
 		Value:  value,
 		Left:   tree.nilNode,
 		Right:  tree.nilNode,
 		Parent: tree.nilNode,
 		Color:  Red,
+		size:   1,
+	}
+}
+
+// Size 返回树中的元素数量
+func (tree *RedBlackTree[K, V]) Size() int {
+	return tree.Root.size
+}
+
+// IsEmpty 判断是否为空
+func (tree *RedBlackTree[K, V]) IsEmpty() bool {
+	return tree.Root == tree.nilNode
+}
+
+// Get 查找键对应的值
+func (tree *RedBlackTree[K, V]) Get(key K) (V, bool) {
+	node := tree.search(key)
+	if node == tree.nilNode {
+		var value V
+		return value, false
+	}
+	return node.Value, true
+}
+
+// Insert 插入键值对，键已存在时覆盖旧值
+func (tree *RedBlackTree[K, V]) Insert(key K, value V) {
+	parent := tree.nilNode
+	cur := tree.Root
+	for cur != tree.nilNode {
+		parent = cur
+		cmp := tree.Comparator(key, cur.Key)
+		switch {
+		case cmp < 0:
+			cur = cur.Left
+		case cmp > 0:
+			cur = cur.Right
+		default:
+			cur.Value = value
+			return
+		}
+	}
+
+	node := tree.newNode(key, value)
+	node.Parent = parent
+	switch {
+	case parent == tree.nilNode:
+		tree.Root = node
+	case tree.Comparator(key, parent.Key) < 0:
+		parent.Left = node
+	default:
+		parent.Right = node
+	}
+	// 新节点路径上的所有祖先重新计算子树信息
+	for p := node; p != tree.nilNode; p = p.Parent {
+		tree.update(p)
 	}
+	tree.insertFixup(node)
 }
 
-func (tree *RedBlackTree[T]) Insert(key T, value interface{}) {
+// Delete 删除指定键，键不存在时不做任何操作
+func (tree *RedBlackTree[K, V]) Delete(key K) {
+	z := tree.search(key)
+	if z == tree.nilNode {
+		return
+	}
+
+	y := z
+	yOriginalColor := y.Color
+	var x *Node[K, V]
+	switch {
+	case z.Left == tree.nilNode:
+		x = z.Right
+		tree.transplant(z, z.Right)
+	case z.Right == tree.nilNode:
+		x = z.Left
+		tree.transplant(z, z.Left)
+	default:
+		y = tree.minimum(z.Right)
+		yOriginalColor = y.Color
+		x = y.Right
+		if y.Parent == z {
+			x.Parent = y
+		} else {
+			tree.transplant(y, y.Right)
+			y.Right = z.Right
+			y.Right.Parent = y
+		}
+		tree.transplant(z, y)
+		y.Left = z.Left
+		y.Left.Parent = y
+		y.Color = z.Color
+	}
+	// 从实际被移除的位置向上重新计算子树信息
+	for p := x.Parent; p != tree.nilNode; p = p.Parent {
+		tree.update(p)
+	}
+	if yOriginalColor == Black {
+		tree.deleteFixup(x)
+	}
+	// 哨兵节点可能在删除过程中被临时修改
+	tree.nilNode.Parent = tree.nilNode
+	tree.nilNode.size = 0
+}
+
+// Min 返回最小的键值对
+func (tree *RedBlackTree[K, V]) Min() (K, V, bool) {
+	if tree.IsEmpty() {
+		return tree.zero()
+	}
+	node := tree.minimum(tree.Root)
+	return node.Key, node.Value, true
+}
 
+// Max 返回最大的键值对
+func (tree *RedBlackTree[K, V]) Max() (K, V, bool) {
+	if tree.IsEmpty() {
+		return tree.zero()
+	}
+	node := tree.maximum(tree.Root)
+	return node.Key, node.Value, true
 }
 
-func (tree *RedBlackTree[T]) Delete(key T) {
+// Floor 返回小于等于 key 的最大键值对
+func (tree *RedBlackTree[K, V]) Floor(key K) (K, V, bool) {
+	return tree.result(tree.lowerBound(key, true))
+}
 
+// Ceiling 返回大于等于 key 的最小键值对
+func (tree *RedBlackTree[K, V]) Ceiling(key K) (K, V, bool) {
+	return tree.result(tree.upperBound(key, true))
+}
+
+// Predecessor 返回严格小于 key 的最大键值对，key 不必存在于树中
+func (tree *RedBlackTree[K, V]) Predecessor(key K) (K, V, bool) {
+	return tree.result(tree.lowerBound(key, false))
+}
+
+// Successor 返回严格大于 key 的最小键值对，key 不必存在于树中
+func (tree *RedBlackTree[K, V]) Successor(key K) (K, V, bool) {
+	return tree.result(tree.upperBound(key, false))
+}
+
+// Rank 返回树中严格小于 key 的元素个数，即 key 在升序中的位置（从 0 开始）
+func (tree *RedBlackTree[K, V]) Rank(key K) int {
+	rank := 0
+	cur := tree.Root
+	for cur != tree.nilNode {
+		cmp := tree.Comparator(key, cur.Key)
+		switch {
+		case cmp < 0:
+			cur = cur.Left
+		case cmp > 0:
+			rank += cur.Left.size + 1
+			cur = cur.Right
+		default:
+			return rank + cur.Left.size
+		}
+	}
+	return rank
+}
+
+// Select 返回升序第 i 个（从 0 开始）键值对，i 越界时返回 false
+func (tree *RedBlackTree[K, V]) Select(i int) (K, V, bool) {
+	if i < 0 || i >= tree.Size() {
+		return tree.zero()
+	}
+	cur := tree.Root
+	for {
+		leftSize := cur.Left.size
+		switch {
+		case i < leftSize:
+			cur = cur.Left
+		case i > leftSize:
+			i -= leftSize + 1
+			cur = cur.Right
+		default:
+			return cur.Key, cur.Value, true
+		}
+	}
+}
+
+// Ascend 按升序遍历所有元素，fn 返回 false 时停止
+func (tree *RedBlackTree[K, V]) Ascend(fn func(key K, value V) bool) {
+	for node := tree.minimum(tree.Root); node != tree.nilNode; node = tree.successor(node) {
+		if !fn(node.Key, node.Value) {
+			return
+		}
+	}
+}
+
+// AscendRange 按升序遍历半开区间 [start, end) 内的元素，fn 返回 false 时停止
+func (tree *RedBlackTree[K, V]) AscendRange(start, end K, fn func(key K, value V) bool) {
+	for node := tree.upperBound(start, true); node != tree.nilNode; node = tree.successor(node) {
+		if tree.Comparator(node.Key, end) >= 0 || !fn(node.Key, node.Value) {
+			return
+		}
+	}
+}
+
+// Descend 按降序遍历所有元素，fn 返回 false 时停止
+func (tree *RedBlackTree[K, V]) Descend(fn func(key K, value V) bool) {
+	for node := tree.maximum(tree.Root); node != tree.nilNode; node = tree.predecessor(node) {
+		if !fn(node.Key, node.Value) {
+			return
+		}
+	}
+}
+
+// DescendRange 从 start（包含）降序遍历到 end（不包含），即区间 (end, start]，fn 返回 false 时停止
+func (tree *RedBlackTree[K, V]) DescendRange(start, end K, fn func(key K, value V) bool) {
+	for node := tree.lowerBound(start, true); node != tree.nilNode; node = tree.predecessor(node) {
+		if tree.Comparator(node.Key, end) <= 0 || !fn(node.Key, node.Value) {
+			return
+		}
+	}
+}
+
+// All 返回按升序遍历所有元素的迭代器
+func (tree *RedBlackTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		tree.Ascend(yield)
+	}
+}
+
+// Backward 返回按降序遍历所有元素的迭代器
+func (tree *RedBlackTree[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		tree.Descend(yield)
+	}
+}
+
+// Range 返回按升序遍历半开区间 [start, end) 的迭代器
+func (tree *RedBlackTree[K, V]) Range(start, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		tree.AscendRange(start, end, yield)
+	}
+}
+
+func (tree *RedBlackTree[K, V]) search(key K) *Node[K, V] {
+	cur := tree.Root
+	for cur != tree.nilNode {
+		cmp := tree.Comparator(key, cur.Key)
+		switch {
+		case cmp < 0:
+			cur = cur.Left
+		case cmp > 0:
+			cur = cur.Right
+		default:
+			return cur
+		}
+	}
+	return tree.nilNode
+}
+
+// lowerBound 查找小于（inclusive 时小于等于）key 的最大节点
+func (tree *RedBlackTree[K, V]) lowerBound(key K, inclusive bool) *Node[K, V] {
+	found := tree.nilNode
+	cur := tree.Root
+	for cur != tree.nilNode {
+		cmp := tree.Comparator(key, cur.Key)
+		if cmp == 0 && inclusive {
+			return cur
+		}
+		if cmp > 0 {
+			found = cur
+			cur = cur.Right
+		} else {
+			cur = cur.Left
+		}
+	}
+	return found
+}
+
+// upperBound 查找大于（inclusive 时大于等于）key 的最小节点
+func (tree *RedBlackTree[K, V]) upperBound(key K, inclusive bool) *Node[K, V] {
+	found := tree.nilNode
+	cur := tree.Root
+	for cur != tree.nilNode {
+		cmp := tree.Comparator(key, cur.Key)
+		if cmp == 0 && inclusive {
+			return cur
+		}
+		if cmp < 0 {
+			found = cur
+			cur = cur.Left
+		} else {
+			cur = cur.Right
+		}
+	}
+	return found
+}
+
+func (tree *RedBlackTree[K, V]) result(node *Node[K, V]) (K, V, bool) {
+	if node == tree.nilNode {
+		return tree.zero()
+	}
+	return node.Key, node.Value, true
+}
+
+func (tree *RedBlackTree[K, V]) zero() (K, V, bool) {
+	var (
+		key   K
+		value V
+	)
+	return key, value, false
+}
+
+func (tree *RedBlackTree[K, V]) minimum(node *Node[K, V]) *Node[K, V] {
+	if node == tree.nilNode {
+		return node
+	}
+	for node.Left != tree.nilNode {
+		node = node.Left
+	}
+	return node
+}
+
+func (tree *RedBlackTree[K, V]) maximum(node *Node[K, V]) *Node[K, V] {
+	if node == tree.nilNode {
+		return node
+	}
+	for node.Right != tree.nilNode {
+		node = node.Right
+	}
+	return node
+}
+
+// successor 返回中序遍历的后继节点
+func (tree *RedBlackTree[K, V]) successor(node *Node[K, V]) *Node[K, V] {
+	if node.Right != tree.nilNode {
+		return tree.minimum(node.Right)
+	}
+	parent := node.Parent
+	for parent != tree.nilNode && node == parent.Right {
+		node = parent
+		parent = parent.Parent
+	}
+	return parent
+}
+
+// predecessor 返回中序遍历的前驱节点
+func (tree *RedBlackTree[K, V]) predecessor(node *Node[K, V]) *Node[K, V] {
+	if node.Left != tree.nilNode {
+		return tree.maximum(node.Left)
+	}
+	parent := node.Parent
+	for parent != tree.nilNode && node == parent.Left {
+		node = parent
+		parent = parent.Parent
+	}
+	return parent
+}
+
+// update 根据左右子树重新计算节点的子树大小和附加信息
+func (tree *RedBlackTree[K, V]) update(node *Node[K, V]) {
+	node.size = node.Left.size + node.Right.size + 1
+	if tree.augment != nil {
+		tree.augment(node)
+	}
+}
+
+// leftRotate 左旋，旋转后重新计算两个节点的子树信息
+func (tree *RedBlackTree[K, V]) leftRotate(x *Node[K, V]) {
+	y := x.Right
+	x.Right = y.Left
+	if y.Left != tree.nilNode {
+		y.Left.Parent = x
+	}
+	y.Parent = x.Parent
+	switch {
+	case x.Parent == tree.nilNode:
+		tree.Root = y
+	case x == x.Parent.Left:
+		x.Parent.Left = y
+	default:
+		x.Parent.Right = y
+	}
+	y.Left = x
+	x.Parent = y
+
+	tree.update(x)
+	tree.update(y)
+}
+
+// rightRotate 右旋，旋转后重新计算两个节点的子树信息
+func (tree *RedBlackTree[K, V]) rightRotate(x *Node[K, V]) {
+	y := x.Left
+	x.Left = y.Right
+	if y.Right != tree.nilNode {
+		y.Right.Parent = x
+	}
+	y.Parent = x.Parent
+	switch {
+	case x.Parent == tree.nilNode:
+		tree.Root = y
+	case x == x.Parent.Right:
+		x.Parent.Right = y
+	default:
+		x.Parent.Left = y
+	}
+	y.Right = x
+	x.Parent = y
+
+	tree.update(x)
+	tree.update(y)
+}
+
+// insertFixup 插入后修复红黑树性质
+func (tree *RedBlackTree[K, V]) insertFixup(z *Node[K, V]) {
+	for z.Parent.Color == Red {
+		if z.Parent == z.Parent.Parent.Left {
+			uncle := z.Parent.Parent.Right
+			if uncle.Color == Red {
+				z.Parent.Color = Black
+				uncle.Color = Black
+				z.Parent.Parent.Color = Red
+				z = z.Parent.Parent
+				continue
+			}
+			if z == z.Parent.Right {
+				z = z.Parent
+				tree.leftRotate(z)
+			}
+			z.Parent.Color = Black
+			z.Parent.Parent.Color = Red
+			tree.rightRotate(z.Parent.Parent)
+		} else {
+			uncle := z.Parent.Parent.Left
+			if uncle.Color == Red {
+				z.Parent.Color = Black
+				uncle.Color = Black
+				z.Parent.Parent.Color = Red
+				z = z.Parent.Parent
+				continue
+			}
+			if z == z.Parent.Left {
+				z = z.Parent
+				tree.rightRotate(z)
+			}
+			z.Parent.Color = Black
+			z.Parent.Parent.Color = Red
+			tree.leftRotate(z.Parent.Parent)
+		}
+	}
+	tree.Root.Color = Black
+}
+
+// transplant 用子树 v 替换子树 u
+func (tree *RedBlackTree[K, V]) transplant(u, v *Node[K, V]) {
+	switch {
+	case u.Parent == tree.nilNode:
+		tree.Root = v
+	case u == u.Parent.Left:
+		u.Parent.Left = v
+	default:
+		u.Parent.Right = v
+	}
+	v.Parent = u.Parent
+}
+
+// deleteFixup 删除后修复红黑树性质
+func (tree *RedBlackTree[K, V]) deleteFixup(x *Node[K, V]) {
+	for x != tree.Root && x.Color == Black {
+		if x == x.Parent.Left {
+			w := x.Parent.Right
+			if w.Color == Red {
+				w.Color = Black
+				x.Parent.Color = Red
+				tree.leftRotate(x.Parent)
+				w = x.Parent.Right
+			}
+			if w.Left.Color == Black && w.Right.Color == Black {
+				w.Color = Red
+				x = x.Parent
+				continue
+			}
+			if w.Right.Color == Black {
+				w.Left.Color = Black
+				w.Color = Red
+				tree.rightRotate(w)
+				w = x.Parent.Right
+			}
+			w.Color = x.Parent.Color
+			x.Parent.Color = Black
+			w.Right.Color = Black
+			tree.leftRotate(x.Parent)
+			x = tree.Root
+		} else {
+			w := x.Parent.Left
+			if w.Color == Red {
+				w.Color = Black
+				x.Parent.Color = Red
+				tree.rightRotate(x.Parent)
+				w = x.Parent.Left
+			}
+			if w.Right.Color == Black && w.Left.Color == Black {
+				w.Color = Red
+				x = x.Parent
+				continue
+			}
+			if w.Left.Color == Black {
+				w.Right.Color = Black
+				w.Color = Red
+				tree.leftRotate(w)
+				w = x.Parent.Left
+			}
+			w.Color = x.Parent.Color
+			x.Parent.Color = Black
+			w.Left.Color = Black
+			tree.rightRotate(x.Parent)
+			x = tree.Root
+		}
+	}
+	x.Color = Black
 }
@@ -0,0 +1,174 @@
+package redblacktree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func intComparator(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// checkInvariants 校验红黑树性质、父指针和子树大小
+func checkInvariants[K, V any](t *testing.T, tree *RedBlackTree[K, V]) {
+	t.Helper()
+	if tree.Root.Color != Black {
+		t.Fatalf("root must be black")
+	}
+	var walk func(n *Node[K, V]) int
+	walk = func(n *Node[K, V]) int {
+		if n == tree.nilNode {
+			return 1
+		}
+		if n.Color == Red && (n.Left.Color == Red || n.Right.Color == Red) {
+			t.Fatalf("red node %v has red child", n.Key)
+		}
+		if n.Left != tree.nilNode && n.Left.Parent != n {
+			t.Fatalf("broken parent link at %v", n.Left.Key)
+		}
+		if n.Right != tree.nilNode && n.Right.Parent != n {
+			t.Fatalf("broken parent link at %v", n.Right.Key)
+		}
+		lh, rh := walk(n.Left), walk(n.Right)
+		if lh != rh {
+			t.Fatalf("black height mismatch at %v: %d != %d", n.Key, lh, rh)
+		}
+		if n.size != n.Left.size+n.Right.size+1 {
+			t.Fatalf("size mismatch at %v", n.Key)
+		}
+		if n.Color == Black {
+			return lh + 1
+		}
+		return lh
+	}
+	walk(tree.Root)
+}
+
+func TestInsertDelete(t *testing.T) {
+	tree := NewRedBlackTree[int, int](intComparator)
+	rnd := rand.New(rand.NewSource(1))
+	expected := map[int]int{}
+
+	for i := 0; i < 2000; i++ {
+		k := rnd.Intn(500)
+		if rnd.Intn(3) == 0 {
+			tree.Delete(k)
+			delete(expected, k)
+		} else {
+			tree.Insert(k, k*10)
+			expected[k] = k * 10
+		}
+		checkInvariants(t, tree)
+	}
+
+	if tree.Size() != len(expected) {
+		t.Fatalf("size = %d, want %d", tree.Size(), len(expected))
+	}
+	for k, v := range expected {
+		got, ok := tree.Get(k)
+		if !ok || got != v {
+			t.Fatalf("Get(%d) = %v, %v; want %d", k, got, ok, v)
+		}
+	}
+
+	var keys []int
+	tree.Ascend(func(k int, _ int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if !sort.IntsAreSorted(keys) || len(keys) != len(expected) {
+		t.Fatalf("Ascend returned unsorted or incomplete keys")
+	}
+}
+
+func TestOrderedQueries(t *testing.T) {
+	tree := NewRedBlackTree[int, int](intComparator)
+	if _, _, ok := tree.Min(); ok {
+		t.Fatalf("Min on empty tree should fail")
+	}
+	for _, k := range []int{10, 20, 30, 40, 50} {
+		tree.Insert(k, k)
+	}
+
+	if k, _, _ := tree.Min(); k != 10 {
+		t.Errorf("Min = %d, want 10", k)
+	}
+	if k, _, _ := tree.Max(); k != 50 {
+		t.Errorf("Max = %d, want 50", k)
+	}
+
+	cases := []struct {
+		name string
+		fn   func(int) (int, int, bool)
+		in   int
+		want int
+		ok   bool
+	}{
+		{"Floor exact", tree.Floor, 30, 30, true},
+		{"Floor between", tree.Floor, 35, 30, true},
+		{"Floor below", tree.Floor, 5, 0, false},
+		{"Ceiling exact", tree.Ceiling, 30, 30, true},
+		{"Ceiling between", tree.Ceiling, 35, 40, true},
+		{"Ceiling above", tree.Ceiling, 55, 0, false},
+		{"Predecessor present", tree.Predecessor, 30, 20, true},
+		{"Predecessor absent", tree.Predecessor, 35, 30, true},
+		{"Predecessor min", tree.Predecessor, 10, 0, false},
+		{"Successor present", tree.Successor, 30, 40, true},
+		{"Successor absent", tree.Successor, 25, 30, true},
+		{"Successor max", tree.Successor, 50, 0, false},
+	}
+	for _, c := range cases {
+		got, _, ok := c.fn(c.in)
+		if ok != c.ok || (ok && got != c.want) {
+			t.Errorf("%s(%d) = %d, %v; want %d, %v", c.name, c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRankSelect(t *testing.T) {
+	tree := NewRedBlackTree[int, int](intComparator)
+	rnd := rand.New(rand.NewSource(2))
+	set := map[int]bool{}
+	for i := 0; i < 300; i++ {
+		k := rnd.Intn(1000)
+		tree.Insert(k, k)
+		set[k] = true
+	}
+	for i := 0; i < 100; i++ {
+		k := rnd.Intn(1000)
+		tree.Delete(k)
+		delete(set, k)
+	}
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	for i, k := range keys {
+		if r := tree.Rank(k); r != i {
+			t.Fatalf("Rank(%d) = %d, want %d", k, r, i)
+		}
+		got, _, ok := tree.Select(i)
+		if !ok || got != k {
+			t.Fatalf("Select(%d) = %d, %v; want %d", i, got, ok, k)
+		}
+	}
+	if r := tree.Rank(-1); r != 0 {
+		t.Fatalf("Rank(-1) = %d, want 0", r)
+	}
+	if r := tree.Rank(1000); r != len(keys) {
+		t.Fatalf("Rank(1000) = %d, want %d", r, len(keys))
+	}
+	if _, _, ok := tree.Select(len(keys)); ok {
+		t.Fatalf("Select out of range should fail")
+	}
+}
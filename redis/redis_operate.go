@@ -121,7 +121,7 @@ func (r *RedisCluster) GetExp(ctx context.Context, keyName string) (int64, error
 
 	value, err := r.singleton().TTL(ctx, r.fixKey(keyName)).Result()
 	if err != nil {
-		log.Errorf("Error trying to get TTL: ", err.Error())
+		log.Errorf("Error trying to get TTL: %s", err.Error())
 
 		return 0, ErrKeyNotFound
 	}
@@ -613,7 +613,7 @@ func (r *RedisCluster) AppendToSet(ctx context.Context, keyName, value string) {
 // Exists check if keyName exists.
 func (r *RedisCluster) Exists(ctx context.Context, keyName string) (bool, error) {
 	fixedKey := r.fixKey(keyName)
-	log.Debug("Checking if exists keyName %s", fixedKey)
+	log.Debugf("Checking if exists keyName %s", fixedKey)
 
 	exists, err := r.singleton().Exists(ctx, fixedKey).Result()
 	if err != nil {
@@ -0,0 +1,264 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/lwm-galactic/logger"
+	"github.com/lwm-galactic/tools/validation"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrConfigNotFound 配置的 key 不存在
+	ErrConfigNotFound = errors.New("config key not found")
+	// ErrConfigDeleted 配置的 key 被删除，继续使用删除前的配置
+	ErrConfigDeleted = errors.New("config key deleted")
+)
+
+// ConfigFormat 配置在 etcd 中的编码格式
+type ConfigFormat string
+
+const (
+	FormatJSON ConfigFormat = "json"
+	FormatYAML ConfigFormat = "yaml"
+)
+
+// ConfigOptions 配置中心的配置
+type ConfigOptions struct {
+	// 编码格式，为空时按 key 的扩展名判断：.yaml、.yml 为 YAML，其他为 JSON
+	Format ConfigFormat
+}
+
+// ConfigOption 配置中心的配置函数
+type ConfigOption func(*ConfigOptions)
+
+// WithConfigFormat 设置编码格式
+func WithConfigFormat(format ConfigFormat) ConfigOption {
+	return func(o *ConfigOptions) {
+		o.Format = format
+	}
+}
+
+// Config 从 etcd 的一个 key 加载的配置，key 变化时自动重新加载
+//
+// 值按 JSON 或 YAML 解码后通过 mapstructure 映射到 T，字段名使用 mapstructure tag，
+// 支持 "5s" 形式的 time.Duration；结构体使用 validation.Validator 按 validate tag 校验。
+// 新的值解码或校验失败时继续使用旧配置；变更回调返回错误时回滚到旧配置。
+// 回滚只发生在本进程内，不会修改 etcd 中的值。
+type Config[T any] struct {
+	client *clientv3.Client
+	key    string
+	format ConfigFormat
+
+	current atomic.Pointer[T]
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mutex    sync.Mutex
+	onChange []func(old, new *T) error
+	onError  []func(error)
+	revision int64 // 已应用或已拒绝的最新版本，避免重复处理
+}
+
+// LoadConfig 加载 key 中的配置并开始监听变化，key 不存在或配置无效时返回错误
+func LoadConfig[T any](ctx context.Context, client *clientv3.Client, key string, opts ...ConfigOption) (*Config[T], error) {
+	options := &ConfigOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	format := options.Format
+	if format == "" {
+		format = FormatJSON
+		if ext := path.Ext(key); ext == ".yaml" || ext == ".yml" {
+			format = FormatYAML
+		}
+	}
+
+	resp, err := client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, key)
+	}
+	cfg, err := decodeConfig[T](resp.Kvs[0].Value, format)
+	if err != nil {
+		return nil, fmt.Errorf("load config %s: %w", key, err)
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	c := &Config[T]{
+		client:   client,
+		key:      key,
+		format:   format,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		revision: resp.Kvs[0].ModRevision,
+	}
+	c.current.Store(cfg)
+	go c.watch(watchCtx, resp.Header.Revision)
+	return c, nil
+}
+
+// Get 返回当前的配置，调用方不能修改返回的值
+func (c *Config[T]) Get() *T {
+	return c.current.Load()
+}
+
+// OnChange 注册配置变更回调，在监听协程中按注册顺序调用
+// 任一回调返回错误时，配置回滚到 old，已经成功的回调会以 (new, old) 再调用一次以撤销变更
+func (c *Config[T]) OnChange(fn func(old, new *T) error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// OnError 注册错误回调，新的值无法解码、校验失败、被回调拒绝或 key 被删除时调用
+func (c *Config[T]) OnError(fn func(error)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onError = append(c.onError, fn)
+}
+
+// Close 停止监听，之后 Get 返回最后一次的配置
+func (c *Config[T]) Close() {
+	c.cancel()
+	<-c.done
+}
+
+// watch 从 rev 之后监听 key，watch 中断时重新读取 key 并续接
+func (c *Config[T]) watch(ctx context.Context, rev int64) {
+	defer close(c.done)
+	for ctx.Err() == nil {
+		ch := c.client.Watch(clientv3.WithRequireLeader(ctx), c.key, clientv3.WithRev(rev+1))
+		for resp := range ch {
+			if resp.Err() != nil {
+				break
+			}
+			for _, ev := range resp.Events {
+				c.handle(ev.Type == clientv3.EventTypeDelete, ev.Kv.Value, ev.Kv.ModRevision)
+			}
+			rev = resp.Header.Revision
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 历史版本可能已被压缩，直接读取当前值
+		resp, err := c.client.Get(ctx, c.key)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Errorf("reload config %s err: %v", c.key, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+		if len(resp.Kvs) == 0 {
+			c.handle(true, nil, resp.Header.Revision)
+		} else {
+			c.handle(false, resp.Kvs[0].Value, resp.Kvs[0].ModRevision)
+		}
+		rev = resp.Header.Revision
+	}
+}
+
+// handle 应用一次变化
+// 回调在释放锁之后调用，回调中可以再调用 OnChange、OnError；watch 协程串行调用 handle，回调不会并发执行
+func (c *Config[T]) handle(deleted bool, value []byte, revision int64) {
+	c.mutex.Lock()
+	if revision <= c.revision {
+		c.mutex.Unlock()
+		return
+	}
+	c.revision = revision
+	onChange := slices.Clone(c.onChange)
+	onError := slices.Clone(c.onError)
+	c.mutex.Unlock()
+
+	if deleted {
+		c.fail(onError, fmt.Errorf("%w: %s", ErrConfigDeleted, c.key))
+		return
+	}
+	cfg, err := decodeConfig[T](value, c.format)
+	if err != nil {
+		c.fail(onError, fmt.Errorf("reload config %s: %w", c.key, err))
+		return
+	}
+
+	old := c.current.Swap(cfg)
+	for i, fn := range onChange {
+		if err := fn(old, cfg); err != nil {
+			// 回滚：恢复旧配置，撤销已经成功的回调
+			c.current.Store(old)
+			for _, undo := range onChange[:i] {
+				if err := undo(cfg, old); err != nil {
+					logger.Errorf("rollback config %s err: %v", c.key, err)
+				}
+			}
+			c.fail(onError, fmt.Errorf("apply config %s, rolled back: %w", c.key, err))
+			return
+		}
+	}
+}
+
+func (c *Config[T]) fail(onError []func(error), err error) {
+	logger.Errorf("%v", err)
+	for _, fn := range onError {
+		fn(err)
+	}
+}
+
+// decodeConfig 解码并校验配置
+func decodeConfig[T any](data []byte, format ConfigFormat) (*T, error) {
+	var raw any
+	var err error
+	switch format {
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &raw)
+	case FormatJSON:
+		err = json.Unmarshal(data, &raw)
+	default:
+		err = fmt.Errorf("unsupported config format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(T)
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           cfg,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(raw); err != nil {
+		return nil, err
+	}
+
+	// validator 只能校验结构体
+	if reflect.TypeFor[T]().Kind() == reflect.Struct {
+		if errs := validation.NewValidator(cfg).Validate(); len(errs) > 0 {
+			return nil, errs.ToAggregate()
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,234 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/internal/etcdtest"
+)
+
+type appConfig struct {
+	Name    string        `mapstructure:"name" validate:"required"`
+	Port    int           `mapstructure:"port" validate:"min=1,max=65535"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	Tags    []string      `mapstructure:"tags"`
+}
+
+// waitConfig 等待直到 cond 对当前配置成立
+func waitConfig[T any](t *testing.T, c *registry.Config[T], cond func(*T) bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(c.Get()); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for config, current %+v", c.Get())
+		}
+	}
+}
+
+func waitError(t *testing.T, errs <-chan error, target error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		if target != nil && !errors.Is(err, target) {
+			t.Fatalf("OnError = %v, want %v", err, target)
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for OnError")
+		return nil
+	}
+}
+
+func TestConfig(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	ctx := context.Background()
+
+	if _, err := registry.LoadConfig[appConfig](ctx, client, "/config/app"); !errors.Is(err, registry.ErrConfigNotFound) {
+		t.Fatalf("LoadConfig missing key = %v, want ErrConfigNotFound", err)
+	}
+	if _, err := client.Put(ctx, "/config/app", `{"name":"app","port":0}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.LoadConfig[appConfig](ctx, client, "/config/app"); err == nil {
+		t.Fatalf("LoadConfig invalid config should fail")
+	}
+
+	if _, err := client.Put(ctx, "/config/app", `{"name":"app","port":8080,"timeout":"3s","tags":"a,b"}`); err != nil {
+		t.Fatal(err)
+	}
+	config, err := registry.LoadConfig[appConfig](ctx, client, "/config/app")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	defer config.Close()
+	if got := config.Get(); got.Name != "app" || got.Port != 8080 || got.Timeout != 3*time.Second || len(got.Tags) != 2 {
+		t.Fatalf("Get = %+v", got)
+	}
+
+	changes := make(chan [2]int, 10)
+	config.OnChange(func(old, new *appConfig) error {
+		changes <- [2]int{old.Port, new.Port}
+		return nil
+	})
+	errs := make(chan error, 10)
+	config.OnError(func(err error) {
+		errs <- err
+	})
+
+	// 有效的修改会通知回调
+	if _, err := client.Put(ctx, "/config/app", `{"name":"app","port":9090}`); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case change := <-changes:
+		if change != [2]int{8080, 9090} {
+			t.Fatalf("OnChange = %v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for OnChange")
+	}
+	if config.Get().Port != 9090 {
+		t.Fatalf("Get after update = %+v", config.Get())
+	}
+
+	// 校验失败、无法解码和删除时继续使用旧配置
+	for _, value := range []string{`{"name":"app","port":0}`, `{"name":`} {
+		if _, err := client.Put(ctx, "/config/app", value); err != nil {
+			t.Fatal(err)
+		}
+		waitError(t, errs, nil)
+	}
+	if _, err := client.Delete(ctx, "/config/app"); err != nil {
+		t.Fatal(err)
+	}
+	waitError(t, errs, registry.ErrConfigDeleted)
+	if config.Get().Port != 9090 || len(changes) != 0 {
+		t.Fatalf("invalid config should be ignored, got %+v", config.Get())
+	}
+
+	// 删除后重新写入继续生效
+	if _, err := client.Put(ctx, "/config/app", `{"name":"app","port":7070}`); err != nil {
+		t.Fatal(err)
+	}
+	waitConfig(t, config, func(c *appConfig) bool { return c.Port == 7070 })
+}
+
+func TestConfigRollback(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	ctx := context.Background()
+	if _, err := client.Put(ctx, "/config/app.yaml", "name: app\nport: 8080\n"); err != nil {
+		t.Fatal(err)
+	}
+	config, err := registry.LoadConfig[appConfig](ctx, client, "/config/app.yaml")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	defer config.Close()
+
+	// 第一个回调成功应用，第二个回调拒绝端口 9999，第一个回调被撤销
+	applied := make(chan int, 10)
+	config.OnChange(func(old, new *appConfig) error {
+		applied <- new.Port
+		return nil
+	})
+	rejected := errors.New("port is reserved")
+	config.OnChange(func(old, new *appConfig) error {
+		if new.Port == 9999 {
+			return rejected
+		}
+		return nil
+	})
+	errs := make(chan error, 10)
+	config.OnError(func(err error) {
+		errs <- err
+	})
+
+	if _, err := client.Put(ctx, "/config/app.yaml", "name: app\nport: 9999\n"); err != nil {
+		t.Fatal(err)
+	}
+	waitError(t, errs, rejected)
+	if config.Get().Port != 8080 {
+		t.Fatalf("config should roll back to 8080, got %+v", config.Get())
+	}
+	for _, want := range []int{9999, 8080} {
+		if got := <-applied; got != want {
+			t.Fatalf("applied port = %d, want %d", got, want)
+		}
+	}
+
+	if _, err := client.Put(ctx, "/config/app.yaml", "name: app\nport: 9000\n"); err != nil {
+		t.Fatal(err)
+	}
+	waitConfig(t, config, func(c *appConfig) bool { return c.Port == 9000 })
+}
+
+func TestConfigCallbackReentrant(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	ctx := context.Background()
+	if _, err := client.Put(ctx, "/config/app", `{"name":"app","port":8080}`); err != nil {
+		t.Fatal(err)
+	}
+	config, err := registry.LoadConfig[appConfig](ctx, client, "/config/app")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	defer config.Close()
+
+	// 回调中注册新的回调不会死锁，新回调从下一次变化开始生效
+	ports := make(chan int, 10)
+	errs := make(chan error, 10)
+	config.OnChange(func(old, new *appConfig) error {
+		config.OnChange(func(old, new *appConfig) error {
+			ports <- new.Port
+			return nil
+		})
+		return nil
+	})
+	config.OnError(func(err error) {
+		config.OnError(func(error) {})
+		errs <- err
+	})
+	for _, port := range []int{9000, 9001} {
+		if _, err := client.Put(ctx, "/config/app", fmt.Sprintf(`{"name":"app","port":%d}`, port)); err != nil {
+			t.Fatal(err)
+		}
+		waitConfig(t, config, func(c *appConfig) bool { return c.Port == port })
+	}
+	select {
+	case port := <-ports:
+		if port != 9001 {
+			t.Fatalf("nested callback got port %d, want 9001", port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nested OnChange callback was not called")
+	}
+	if _, err := client.Put(ctx, "/config/app", `{"name":`); err != nil {
+		t.Fatal(err)
+	}
+	waitError(t, errs, nil)
+}
+
+func TestConfigRegistryOptions(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	ctx := context.Background()
+	value := "prefix: /services\nnamespace: prod\nendpoints: [10.0.0.1:2379, 10.0.0.2:2379]\ndial_timeout: 3s\n"
+	if _, err := client.Put(ctx, "/config/registry", value); err != nil {
+		t.Fatal(err)
+	}
+	config, err := registry.LoadConfig[registry.Options](ctx, client, "/config/registry", registry.WithConfigFormat(registry.FormatYAML))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	defer config.Close()
+	got := config.Get()
+	if got.Prefix != "/services" || got.Namespace != "prod" || len(got.Endpoints) != 2 || got.DialTimeout != 3*time.Second {
+		t.Fatalf("Get = %+v", got)
+	}
+}
@@ -0,0 +1,195 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrNoInstances 服务当前没有可用实例
+var ErrNoInstances = errors.New("no available service instances")
+
+// Discovery 客户端服务发现缓存
+// 每个服务名只订阅一次，本地缓存由 watch 持续更新，Pick 直接在缓存上做负载均衡，不访问 etcd。
+// etcd 不可用时 watch 不会产生新的列表，缓存中保留最后一次成功获取的实例。
+type Discovery struct {
+	registry Registry
+
+	mutex    sync.Mutex
+	services map[string]*serviceCache
+}
+
+// serviceCache 单个服务的缓存
+type serviceCache struct {
+	mutex     sync.RWMutex
+	instances []*Service
+	healthy   []*Service    // instances 中未被健康检查标记为不健康的实例
+	err       error         // 首次同步失败的原因
+	ready     chan struct{} // 首次同步完成（成功或失败）后关闭
+	cancel    CancelFunc    // 取消订阅，首次同步成功后设置
+}
+
+// NewDiscovery 创建基于 registry 订阅的服务发现缓存
+func NewDiscovery(registry Registry) *Discovery {
+	return &Discovery{
+		registry: registry,
+		services: make(map[string]*serviceCache),
+	}
+}
+
+// Watch 开始订阅服务，重复调用不会重复订阅
+// 首次同步在后台进行，可以通过 Ready 或 WaitReady 判断是否完成
+func (d *Discovery) Watch(name string) {
+	d.cache(name)
+}
+
+// Ready 判断服务是否已完成首次同步
+func (d *Discovery) Ready(name string) bool {
+	d.mutex.Lock()
+	c, ok := d.services[name]
+	d.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case <-c.ready:
+		return c.err == nil
+	default:
+		return false
+	}
+}
+
+// WaitReady 等待所有服务完成首次同步，未订阅的服务会自动订阅
+func (d *Discovery) WaitReady(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		if _, err := d.wait(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Instances 返回服务当前缓存的实例列表，未完成首次同步时返回 nil
+func (d *Discovery) Instances(name string) []*Service {
+	if !d.Ready(name) {
+		return nil
+	}
+	d.mutex.Lock()
+	c := d.services[name]
+	d.mutex.Unlock()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return slices.Clone(c.instances)
+}
+
+// Pick 按 strategy 从缓存的健康实例中选择一个，strategy 为 nil 时随机选择
+// 服务未订阅时自动订阅，并在 ctx 结束前等待首次同步完成
+func (d *Discovery) Pick(ctx context.Context, name string, strategy Strategy) (*Service, error) {
+	c, err := d.wait(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == nil {
+		strategy = RandomStrategy()
+	}
+	c.mutex.RLock()
+	instances := c.healthy
+	c.mutex.RUnlock()
+	// 缓存更新时整体替换切片，这里拿到的切片不会再被修改
+	svc := strategy(instances)
+	if svc == nil {
+		return nil, ErrNoInstances
+	}
+	return svc, nil
+}
+
+// cache 返回服务的缓存，不存在时创建并在后台订阅
+func (d *Discovery) cache(name string) *serviceCache {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if c, ok := d.services[name]; ok {
+		return c
+	}
+	c := &serviceCache{ready: make(chan struct{})}
+	d.services[name] = c
+	go d.subscribe(name, c)
+	return c
+}
+
+func (d *Discovery) subscribe(name string, c *serviceCache) {
+	var once sync.Once
+	cancel, err := d.registry.Subscribe(name, func(services []*Service) {
+		healthy := HealthyInstances(services)
+		c.mutex.Lock()
+		c.instances = services
+		c.healthy = healthy
+		c.mutex.Unlock()
+		once.Do(func() {
+			close(c.ready)
+		})
+	})
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err != nil {
+		// 首次同步失败，移除缓存以便下次调用时重新订阅
+		if d.services[name] == c {
+			delete(d.services, name)
+		}
+		once.Do(func() {
+			c.err = err
+			close(c.ready)
+		})
+		return
+	}
+	if d.services[name] != c {
+		// 订阅期间缓存已被 Close 移除
+		cancel()
+		return
+	}
+	c.cancel = cancel
+}
+
+// Close 取消所有订阅并清空缓存
+func (d *Discovery) Close() {
+	d.mutex.Lock()
+	services := d.services
+	d.services = make(map[string]*serviceCache)
+	d.mutex.Unlock()
+	for _, c := range services {
+		if c.cancel != nil {
+			c.cancel()
+		}
+	}
+}
+
+// HealthyInstances 返回未被健康检查标记为不健康的实例
+// 全部健康时直接返回 services，不复制
+func HealthyInstances(services []*Service) []*Service {
+	for i, svc := range services {
+		if svc.IsHealthy() {
+			continue
+		}
+		healthy := slices.Clone(services[:i])
+		for _, svc := range services[i+1:] {
+			if svc.IsHealthy() {
+				healthy = append(healthy, svc)
+			}
+		}
+		return healthy
+	}
+	return services
+}
+
+func (d *Discovery) wait(ctx context.Context, name string) (*serviceCache, error) {
+	c := d.cache(name)
+	select {
+	case <-c.ready:
+		if c.err != nil {
+			return nil, c.err
+		}
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry 只实现订阅，由测试手动推送实例列表
+type fakeRegistry struct {
+	mutex     sync.Mutex
+	callbacks map[string][]func([]*Service)
+	initial   map[string][]*Service
+	err       error
+	block     chan struct{} // 不为 nil 时 Subscribe 阻塞到该通道关闭
+	cancelled int
+}
+
+func (f *fakeRegistry) Register(context.Context, *Service) error   { return nil }
+func (f *fakeRegistry) Unregister(context.Context, *Service) error { return nil }
+func (f *fakeRegistry) Close() error                               { return nil }
+
+func (f *fakeRegistry) MarkHealth(context.Context, *Service, bool) error {
+	return errors.New("not implemented")
+}
+
+func (f *fakeRegistry) SubscribeEvents(string, func([]ServiceEvent)) (CancelFunc, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeRegistry) Subscribe(name string, callback func([]*Service)) (CancelFunc, error) {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.callbacks == nil {
+		f.callbacks = make(map[string][]func([]*Service))
+	}
+	f.callbacks[name] = append(f.callbacks[name], callback)
+	callback(f.initial[name])
+	return func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.cancelled++
+	}, nil
+}
+
+func (f *fakeRegistry) push(name string, services []*Service) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, cb := range f.callbacks[name] {
+		cb(services)
+	}
+}
+
+func TestDiscoveryPick(t *testing.T) {
+	reg := &fakeRegistry{initial: map[string][]*Service{"order": newInstances(2)}}
+	d := NewDiscovery(reg)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	svc, err := d.Pick(ctx, "order", RoundRobinStrategy())
+	if err != nil || svc == nil {
+		t.Fatalf("Pick = %v, %v", svc, err)
+	}
+	if !d.Ready("order") || len(d.Instances("order")) != 2 {
+		t.Fatalf("discovery should be ready with 2 instances")
+	}
+	// 同一个服务只订阅一次
+	d.Pick(ctx, "order", nil)
+	if n := len(reg.callbacks["order"]); n != 1 {
+		t.Fatalf("subscribed %d times, want 1", n)
+	}
+
+	reg.push("order", nil)
+	if _, err := d.Pick(ctx, "order", nil); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("Pick with no instances = %v, want ErrNoInstances", err)
+	}
+	reg.push("order", newInstances(3))
+	if n := len(d.Instances("order")); n != 3 {
+		t.Fatalf("cached %d instances, want 3", n)
+	}
+
+	d.Close()
+	if d.Ready("order") {
+		t.Fatalf("Close should drop the cache")
+	}
+	// 订阅协程可能在 Close 之后才拿到取消函数，由它自己取消
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		reg.mutex.Lock()
+		cancelled := reg.cancelled
+		reg.mutex.Unlock()
+		if cancelled == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Close should cancel the subscription, cancelled = %d", cancelled)
+		}
+	}
+}
+
+func TestDiscoveryReadiness(t *testing.T) {
+	reg := &fakeRegistry{block: make(chan struct{})}
+	d := NewDiscovery(reg)
+	d.Watch("order")
+	if d.Ready("order") {
+		t.Fatalf("should not be ready before the first sync")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := d.Pick(ctx, "order", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Pick before sync = %v, want DeadlineExceeded", err)
+	}
+
+	close(reg.block)
+	if err := d.WaitReady(context.Background(), "order"); err != nil {
+		t.Fatalf("WaitReady: %v", err)
+	}
+	if !d.Ready("order") {
+		t.Fatalf("should be ready after the first sync")
+	}
+}
+
+func TestDiscoverySubscribeError(t *testing.T) {
+	reg := &fakeRegistry{err: errors.New("etcd unavailable")}
+	d := NewDiscovery(reg)
+	if err := d.WaitReady(context.Background(), "order"); err == nil {
+		t.Fatalf("WaitReady should report the subscribe error")
+	}
+
+	// 下次调用会重新订阅
+	reg.mutex.Lock()
+	reg.err = nil
+	reg.initial = map[string][]*Service{"order": newInstances(1)}
+	reg.mutex.Unlock()
+	if _, err := d.Pick(context.Background(), "order", nil); err != nil {
+		t.Fatalf("Pick after recovery: %v", err)
+	}
+}
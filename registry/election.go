@@ -0,0 +1,440 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lwm-galactic/logger"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+var (
+	// ErrNoLeader 当前没有领导者
+	ErrNoLeader = errors.New("election has no leader")
+	// ErrElectionClosed 选举已关闭
+	ErrElectionClosed = errors.New("election is closed")
+)
+
+// ElectionOptions 选举的配置
+type ElectionOptions struct {
+	// 选举 key 的前缀，完整前缀为 <Prefix>/<name>
+	Prefix string
+	// 候选者会话的租约时长，领导者进程崩溃后最多经过该时长重新选举，按秒取整，最小 1s
+	TTL time.Duration
+}
+
+// ElectionOption 选举的配置函数
+type ElectionOption func(*ElectionOptions)
+
+// WithElectionPrefix 设置选举 key 的前缀
+func WithElectionPrefix(prefix string) ElectionOption {
+	return func(o *ElectionOptions) {
+		o.Prefix = prefix
+	}
+}
+
+// WithElectionTTL 设置候选者会话的租约时长
+func WithElectionTTL(ttl time.Duration) ElectionOption {
+	return func(o *ElectionOptions) {
+		o.TTL = ttl
+	}
+}
+
+// NewElectionOptions 创建选举的配置，默认前缀 /elections，租约 15s
+func NewElectionOptions(opts ...ElectionOption) *ElectionOptions {
+	options := &ElectionOptions{
+		Prefix: "/elections",
+		TTL:    15 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// LeaderEvent 领导者变化的通知
+type LeaderEvent struct {
+	Leader   *Service // 当前领导者，没有领导者时为 nil
+	IsLeader bool     // 自己是否是领导者
+}
+
+// Election 基于 concurrency.Election 的领导者选举，用于在多个副本中只运行一个的后台任务
+// 领导者的值是候选者的 Service 信息，其他副本可以通过 Leader 知道谁在领导。
+// Campaign 成功后在后台保持领导权，会话丢失（例如租约过期）或自己的候选 key 被删除时失去领导权并自动重新竞选，
+// 直到 Resign 或 Close。
+type Election struct {
+	client *clientv3.Client
+	prefix string
+	svc    *Service
+	ttl    int
+
+	ctx     context.Context // Close 时取消，停止观察领导者
+	cancel  context.CancelFunc
+	changes chan LeaderEvent
+	wg      sync.WaitGroup
+
+	mutex    sync.Mutex
+	campaign *campaign // 进行中的竞选，Resign 后为 nil
+	leader   *Service  // 观察到的领导者
+	leading  bool
+	closed   bool
+}
+
+// campaign 一次 Campaign 启动的竞选循环
+type campaign struct {
+	cancel  context.CancelFunc
+	elected chan struct{} // 首次当选后关闭
+	done    chan struct{} // 竞选循环退出后关闭
+	once    sync.Once
+	waiters int // 等待当选的 Campaign 调用数，由 Election.mutex 保护
+}
+
+func (c *campaign) isElected() bool {
+	select {
+	case <-c.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewElection 在 <prefix>/<name> 上创建选举，svc 是自己作为领导者时对外公布的信息，只观察时可以为 nil
+// 基于已有的 etcd 客户端，Close 时不会关闭该客户端
+func NewElection(client *clientv3.Client, name string, svc *Service, opts ...ElectionOption) *Election {
+	options := NewElectionOptions(opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Election{
+		client:  client,
+		prefix:  options.Prefix + "/" + name,
+		svc:     svc,
+		ttl:     max(int(options.TTL/time.Second), 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		changes: make(chan LeaderEvent, 1),
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.observe(ctx)
+	}()
+	return e
+}
+
+// Campaign 参加竞选，阻塞直到当选或 ctx 结束
+// 已经在竞选时等待当前的竞选结果；可以并发调用，只有所有调用者的 ctx 都结束且尚未当选时才退出竞选。
+// Resign 或 Close 导致竞选结束时返回 ErrElectionClosed。
+func (e *Election) Campaign(ctx context.Context) error {
+	if e.svc == nil {
+		return errors.New("election candidate service is required")
+	}
+	value, err := e.svc.marshal()
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	if e.closed {
+		e.mutex.Unlock()
+		return ErrElectionClosed
+	}
+	c := e.campaign
+	if c == nil {
+		runCtx, cancel := context.WithCancel(e.ctx)
+		c = &campaign{cancel: cancel, elected: make(chan struct{}), done: make(chan struct{})}
+		e.campaign = c
+		go e.run(runCtx, c, value)
+	}
+	c.waiters++
+	e.mutex.Unlock()
+
+	select {
+	case <-c.elected:
+	case <-c.done:
+		err = ErrElectionClosed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	e.mutex.Lock()
+	c.waiters--
+	elected := c.isElected()
+	// 最后一个等待者的 ctx 结束且尚未当选时退出竞选，ctx 结束的同时已经当选则保持领导权
+	withdraw := !elected && ctx.Err() != nil && c.waiters == 0 && e.campaign == c
+	if withdraw {
+		e.campaign = nil
+	}
+	e.mutex.Unlock()
+	if withdraw {
+		c.cancel()
+		<-c.done
+	}
+	if elected {
+		return nil
+	}
+	return err
+}
+
+// Resign 退出竞选，是领导者时放弃领导权
+func (e *Election) Resign(ctx context.Context) error {
+	e.mutex.Lock()
+	c := e.campaign
+	e.campaign = nil
+	e.mutex.Unlock()
+	if c == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Leader 查询当前的领导者，没有领导者时返回 ErrNoLeader
+func (e *Election) Leader(ctx context.Context) (*Service, error) {
+	resp, err := e.client.Get(ctx, e.prefix+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNoLeader
+	}
+	return unmarshalService(resp.Kvs[0].Value)
+}
+
+// IsLeader 判断自己当前是否是领导者
+func (e *Election) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.leading
+}
+
+// Changes 返回领导者变化的通知，只保留最新的一个事件，处理不及时时中间的事件会被丢弃
+func (e *Election) Changes() <-chan LeaderEvent {
+	return e.changes
+}
+
+// Close 退出竞选并停止观察领导者
+func (e *Election) Close() error {
+	e.mutex.Lock()
+	if e.closed {
+		e.mutex.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	err := e.Resign(ctx)
+	e.cancel()
+	e.wg.Wait()
+	return err
+}
+
+// run 竞选循环：当选后保持领导权，会话丢失时用新的会话重新竞选，ctx 结束时放弃领导权
+func (e *Election) run(ctx context.Context, c *campaign, value string) {
+	defer close(c.done)
+	backoff := minReregisterBackoff
+	retry := func(err error) bool {
+		logger.Errorf("campaign %s err: %v", e.prefix, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxReregisterBackoff)
+		return true
+	}
+	for {
+		// 会话的租约由客户端自动续约，ctx 结束时停止续约
+		session, err := concurrency.NewSession(e.client, concurrency.WithTTL(e.ttl), concurrency.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil || !retry(err) {
+				return
+			}
+			continue
+		}
+		election := concurrency.NewElection(session, e.prefix)
+		if err := election.Campaign(ctx, value); err != nil {
+			e.closeSession(session)
+			if ctx.Err() != nil || !retry(err) {
+				return
+			}
+			continue
+		}
+		backoff = minReregisterBackoff
+		e.setLeading(true)
+		c.once.Do(func() {
+			close(c.elected)
+		})
+
+		monitorCtx, stopMonitor := context.WithCancel(ctx)
+		lost := make(chan struct{})
+		go func() {
+			defer close(lost)
+			e.monitor(monitorCtx, session, election.Key(), election.Rev())
+		}()
+		select {
+		case <-ctx.Done():
+		case <-lost:
+		}
+		stopMonitor()
+		<-lost
+		// 会话跟随 ctx，ctx 结束时 monitor 也会退出，优先按主动退出处理
+		if ctx.Err() != nil {
+			resignCtx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+			if err := election.Resign(resignCtx); err != nil {
+				logger.Errorf("resign %s err: %v", e.prefix, err)
+			}
+			cancel()
+			e.closeSession(session)
+			e.setLeading(false)
+			return
+		}
+		logger.Errorf("leadership of %s lost, campaign again", e.prefix)
+		e.closeSession(session)
+		e.setLeading(false)
+	}
+}
+
+// monitor 监听自己的候选 key，直到会话丢失、key 被删除或 ctx 结束
+// key 可能在租约仍有效时被运维或其他工具删除，此时其他候选者会当选，自己必须放弃领导权
+func (e *Election) monitor(ctx context.Context, session *concurrency.Session, key string, rev int64) {
+	for {
+		if e.watchKey(ctx, session, key, rev) || ctx.Err() != nil {
+			return
+		}
+		// watch 中断（例如历史版本已被压缩），确认 key 仍然存在后从当前版本重新监听
+		resp, err := e.client.Get(ctx, key)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil && len(resp.Kvs) == 0:
+			return
+		case err == nil:
+			rev = resp.Header.Revision
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-session.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// watchKey 从 rev 之后监听候选 key，返回是否失去领导权；watch 中断或 ctx 结束时返回 false
+func (e *Election) watchKey(ctx context.Context, session *concurrency.Session, key string, rev int64) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := e.client.Watch(ctx, key, clientv3.WithRev(rev+1))
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-session.Done():
+			return true
+		case resp, ok := <-ch:
+			if !ok || resp.Err() != nil {
+				return false
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == clientv3.EventTypeDelete {
+					return true
+				}
+			}
+		}
+	}
+}
+
+// closeSession 撤销会话的租约，会话的 ctx 可能已经结束，使用独立的超时
+func (e *Election) closeSession(session *concurrency.Session) {
+	session.Orphan()
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	_, _ = e.client.Revoke(ctx, session.Lease())
+}
+
+func (e *Election) setLeading(leading bool) {
+	e.mutex.Lock()
+	changed := e.leading != leading
+	e.leading = leading
+	e.mutex.Unlock()
+	if changed {
+		e.notify()
+	}
+}
+
+func (e *Election) setLeader(leader *Service) {
+	e.mutex.Lock()
+	e.leader = leader
+	e.mutex.Unlock()
+	e.notify()
+}
+
+// notify 发送最新的状态，替换掉还没有被取走的旧事件
+func (e *Election) notify() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	event := LeaderEvent{Leader: e.leader, IsLeader: e.leading}
+	select {
+	case <-e.changes:
+	default:
+	}
+	e.changes <- event
+}
+
+// observe 监听选举前缀，领导者变化时通知
+func (e *Election) observe(ctx context.Context) {
+	var (
+		currentKey string // 当前领导者的 key 和版本，用于判断是否变化
+		currentRev int64
+	)
+	for ctx.Err() == nil {
+		resp, err := e.client.Get(ctx, e.prefix+"/", clientv3.WithFirstCreate()...)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Errorf("get leader of %s err: %v", e.prefix, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+		var (
+			key    string
+			rev    int64
+			leader *Service
+		)
+		if len(resp.Kvs) > 0 {
+			kv := resp.Kvs[0]
+			key, rev = string(kv.Key), kv.ModRevision
+			if leader, err = unmarshalService(kv.Value); err != nil {
+				logger.Errorf("invalid leader of %s: %v", e.prefix, err)
+			}
+		}
+		if key != currentKey || rev != currentRev {
+			currentKey, currentRev = key, rev
+			e.setLeader(leader)
+		}
+
+		// 前缀下有任何变化都重新查询领导者
+		watchCtx, cancel := context.WithCancel(ctx)
+		ch := e.client.Watch(watchCtx, e.prefix+"/", clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for wr := range ch {
+			if wr.Err() != nil || len(wr.Events) > 0 {
+				break
+			}
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,221 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/internal/etcdtest"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func newCandidate(t *testing.T, server *etcdtest.Server, id string) *registry.Election {
+	t.Helper()
+	svc := &registry.Service{ID: id, Name: "cron", Addr: "127.0.0.1", Port: 9000}
+	e := registry.NewElection(server.Client(t), "cron", svc, registry.WithElectionTTL(time.Second))
+	t.Cleanup(func() {
+		_ = e.Close()
+	})
+	return e
+}
+
+// waitLeader 等待直到收到领导者为 id 的事件
+func waitLeader(t *testing.T, e *registry.Election, id string, isLeader bool) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev := <-e.Changes():
+			if ev.Leader != nil && ev.Leader.ID == id && ev.IsLeader == isLeader {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for leader %s (isLeader=%v)", id, isLeader)
+		}
+	}
+}
+
+func TestElection(t *testing.T) {
+	server := etcdtest.Start(t)
+	a, b := newCandidate(t, server, "a"), newCandidate(t, server, "b")
+	ctx := context.Background()
+
+	if _, err := a.Leader(ctx); !errors.Is(err, registry.ErrNoLeader) {
+		t.Fatalf("Leader before campaign = %v, want ErrNoLeader", err)
+	}
+	if err := a.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign: %v", err)
+	}
+	if !a.IsLeader() {
+		t.Fatalf("a should be leader")
+	}
+	waitLeader(t, a, "a", true)
+	waitLeader(t, b, "a", false)
+	leader, err := b.Leader(ctx)
+	if err != nil || leader.ID != "a" || leader.Endpoint() != "127.0.0.1:9000" {
+		t.Fatalf("Leader = %+v, %v", leader, err)
+	}
+
+	// 已有领导者时竞选会等待，ctx 结束时退出竞选
+	timeout, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	if err := b.Campaign(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Campaign while led = %v, want DeadlineExceeded", err)
+	}
+	if b.IsLeader() {
+		t.Fatalf("b should not be leader")
+	}
+
+	// 领导者放弃后等待中的候选者当选
+	elected := make(chan error, 1)
+	go func() {
+		elected <- b.Campaign(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := a.Resign(ctx); err != nil {
+		t.Fatalf("Resign: %v", err)
+	}
+	select {
+	case err := <-elected:
+		if err != nil {
+			t.Fatalf("Campaign: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("b was not elected after a resigned")
+	}
+	if a.IsLeader() || !b.IsLeader() {
+		t.Fatalf("leadership should move to b, a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+	waitLeader(t, a, "b", false)
+}
+
+func TestElectionSessionLost(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	a := newCandidate(t, server, "a")
+	ctx := context.Background()
+	if err := a.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign: %v", err)
+	}
+	waitLeader(t, a, "a", true)
+
+	// 撤销领导者的租约，模拟会话丢失，之后自动重新竞选
+	resp, err := client.Get(ctx, "/elections/cron/", clientv3.WithPrefix())
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("Get = %v, %v", resp, err)
+	}
+	lease := clientv3.LeaseID(resp.Kvs[0].Lease)
+	if _, err := client.Revoke(ctx, lease); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		resp, err := client.Get(ctx, "/elections/cron/", clientv3.WithPrefix())
+		if err == nil && len(resp.Kvs) == 1 && clientv3.LeaseID(resp.Kvs[0].Lease) != lease && a.IsLeader() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("a should be elected again with a new session")
+		}
+	}
+
+	// Close 放弃领导权
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if a.IsLeader() {
+		t.Fatalf("a should not be leader after Close")
+	}
+	resp, err = client.Get(ctx, "/elections/cron/", clientv3.WithPrefix())
+	if err != nil || len(resp.Kvs) != 0 {
+		t.Fatalf("election key should be deleted after Close, got %v, %v", resp, err)
+	}
+	if err := a.Campaign(ctx); !errors.Is(err, registry.ErrElectionClosed) {
+		t.Fatalf("Campaign after Close = %v, want ErrElectionClosed", err)
+	}
+}
+
+func TestElectionKeyDeleted(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	a, b := newCandidate(t, server, "a"), newCandidate(t, server, "b")
+	ctx := context.Background()
+	if err := a.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign: %v", err)
+	}
+	elected := make(chan error, 1)
+	go func() {
+		elected <- b.Campaign(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 租约仍有效时领导者的 key 被删除，b 当选，a 放弃领导权并重新排队
+	resp, err := client.Get(ctx, "/elections/cron/", clientv3.WithFirstCreate()...)
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("Get leader key = %v, %v", resp, err)
+	}
+	if _, err := client.Delete(ctx, string(resp.Kvs[0].Key)); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	select {
+	case err := <-elected:
+		if err != nil {
+			t.Fatalf("Campaign: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("b was not elected after the leader key was deleted")
+	}
+	for deadline := time.Now().Add(10 * time.Second); a.IsLeader(); time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("a should give up leadership after its key was deleted")
+		}
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		resp, err := client.Get(ctx, "/elections/cron/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err == nil && resp.Count == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("a should campaign again after losing leadership")
+		}
+	}
+	if !b.IsLeader() || a.IsLeader() {
+		t.Fatalf("b should stay the only leader, a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+}
+
+func TestElectionConcurrentCampaign(t *testing.T) {
+	server := etcdtest.Start(t)
+	a, b := newCandidate(t, server, "a"), newCandidate(t, server, "b")
+	ctx := context.Background()
+	if err := a.Campaign(ctx); err != nil {
+		t.Fatalf("Campaign: %v", err)
+	}
+
+	// 一个调用者的 ctx 结束不影响其他仍在等待的调用者
+	elected := make(chan error, 1)
+	go func() {
+		elected <- b.Campaign(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := b.Campaign(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Campaign with timeout = %v, want DeadlineExceeded", err)
+	}
+	if err := a.Resign(ctx); err != nil {
+		t.Fatalf("Resign: %v", err)
+	}
+	select {
+	case err := <-elected:
+		if err != nil {
+			t.Fatalf("Campaign: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("b was not elected after a resigned")
+	}
+	if !b.IsLeader() {
+		t.Fatalf("b should be leader")
+	}
+}
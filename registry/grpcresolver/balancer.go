@@ -0,0 +1,54 @@
+package grpcresolver
+
+import (
+	"github.com/lwm-galactic/tools/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// BalancerName 加权轮询均衡器的名称
+const BalancerName = "etcd_weighted_round_robin"
+
+// WeightedServiceConfig 启用加权轮询均衡器的服务配置，用于 grpc.WithDefaultServiceConfig
+const WeightedServiceConfig = `{"loadBalancingConfig":[{"` + BalancerName + `":{}}]}`
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(BalancerName, &weightedPickerBuilder{}, base.Config{}))
+}
+
+// weightedPickerBuilder 根据地址上的 Service.Weight 构建平滑加权轮询的 picker
+type weightedPickerBuilder struct{}
+
+// Build 实现 base.PickerBuilder 接口，只包含已就绪的连接
+func (*weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &weightedPicker{
+		strategy: registry.WeightedRoundRobinStrategy(),
+		subConns: make(map[*registry.Service]balancer.SubConn, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		svc, ok := ServiceFromAddress(sci.Address)
+		if !ok {
+			// 不是由本包解析的地址，按权重 1 处理
+			svc = &registry.Service{Addr: sci.Address.Addr}
+		}
+		p.services = append(p.services, svc)
+		p.subConns[svc] = sc
+	}
+	return p
+}
+
+// weightedPicker 复用 registry 的平滑加权轮询策略，策略本身是并发安全的
+type weightedPicker struct {
+	strategy registry.Strategy
+	services []*registry.Service
+	subConns map[*registry.Service]balancer.SubConn
+}
+
+// Pick 实现 balancer.Picker 接口
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	svc := p.strategy(p.services)
+	return balancer.PickResult{SubConn: p.subConns[svc]}, nil
+}
@@ -0,0 +1,123 @@
+// Package grpcresolver 将 registry 中注册的服务接入 gRPC 客户端
+//
+// 解析器处理 etcd:///service-name 形式的地址，基于 Registry.Subscribe 实时更新实例列表，
+// 每个地址都携带对应的 registry.Service，加权均衡器据此按 Weight 分配请求：
+//
+//	conn, err := grpc.NewClient("etcd:///order",
+//		grpc.WithResolvers(grpcresolver.NewBuilder(reg)),
+//		grpc.WithDefaultServiceConfig(grpcresolver.WeightedServiceConfig),
+//		grpc.WithTransportCredentials(insecure.NewCredentials()),
+//	)
+//
+// 解析出的地址不设置 ServerName，使用 TLS 时默认按服务名校验证书，
+// 证书中的主机名不同时通过 grpc.WithAuthority 或 tls.Config.ServerName 指定。
+package grpcresolver
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/lwm-galactic/tools/registry"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme 解析器使用的地址 scheme
+const Scheme = "etcd"
+
+// builder 基于 Registry 的解析器构造器
+type builder struct {
+	registry registry.Registry
+}
+
+// NewBuilder 创建解析器构造器，可以通过 grpc.WithResolvers 或 resolver.Register 使用
+func NewBuilder(reg registry.Registry) resolver.Builder {
+	return &builder{registry: reg}
+}
+
+// Scheme 实现 resolver.Builder 接口
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+// Build 实现 resolver.Builder 接口，订阅 target 中的服务名
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &etcdResolver{cc: cc}
+	name := strings.TrimPrefix(target.Endpoint(), "/")
+	cancel, err := b.registry.Subscribe(name, r.update)
+	if err != nil {
+		return nil, err
+	}
+	r.cancel = cancel
+	return r, nil
+}
+
+// etcdResolver 将订阅到的实例列表推送给 gRPC
+type etcdResolver struct {
+	cc     resolver.ClientConn
+	cancel registry.CancelFunc
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (r *etcdResolver) update(services []*registry.Service) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	// 跳过被健康检查标记为不健康的实例，恢复后会随下一次更新重新加入
+	services = registry.HealthyInstances(services)
+	addrs := make([]resolver.Address, 0, len(services))
+	for _, svc := range services {
+		// 不设置 ServerName，TLS 校验使用目标地址的 authority 或 grpc.WithAuthority 指定的名字，
+		// 服务名不是证书中的主机名，不能由解析器替调用方决定
+		addrs = append(addrs, resolver.Address{
+			Addr:       svc.Endpoint(),
+			Attributes: attributes.New(serviceKey{}, serviceAttr{svc: svc}),
+		})
+	}
+	// 基于 watch 的解析器，重新解析不会得到不同的结果，忽略返回的错误
+	_ = r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// ResolveNow 实现 resolver.Resolver 接口，实例列表由 watch 推送，无需主动解析
+func (r *etcdResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close 实现 resolver.Resolver 接口，取消订阅
+func (r *etcdResolver) Close() {
+	r.mutex.Lock()
+	r.closed = true
+	r.mutex.Unlock()
+	r.cancel()
+}
+
+// ServiceFromAddress 返回解析器为地址附加的服务信息
+func ServiceFromAddress(addr resolver.Address) (*registry.Service, bool) {
+	attr, ok := addr.Attributes.Value(serviceKey{}).(serviceAttr)
+	if !ok {
+		return nil, false
+	}
+	return attr.svc, true
+}
+
+type serviceKey struct{}
+
+// serviceAttr 地址属性中保存的服务信息
+// gRPC 用属性判断地址是否变化，变化时会重建连接，因此比较时忽略每次拉取都会刷新的 LastHeartbeat
+type serviceAttr struct {
+	svc *registry.Service
+}
+
+// Equal 实现 attributes 的比较约定
+func (a serviceAttr) Equal(o any) bool {
+	other, ok := o.(serviceAttr)
+	if !ok {
+		return false
+	}
+	x, y := *a.svc, *other.svc
+	x.LastHeartbeat = y.LastHeartbeat
+	return reflect.DeepEqual(x, y)
+}
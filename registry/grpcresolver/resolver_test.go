@@ -0,0 +1,211 @@
+package grpcresolver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+)
+
+// staticRegistry 订阅时返回固定的实例列表
+type staticRegistry struct {
+	mutex     sync.Mutex
+	services  []*registry.Service
+	callbacks []func([]*registry.Service)
+}
+
+func (s *staticRegistry) Register(context.Context, *registry.Service) error   { return nil }
+func (s *staticRegistry) Unregister(context.Context, *registry.Service) error { return nil }
+func (s *staticRegistry) Close() error                                        { return nil }
+
+func (s *staticRegistry) MarkHealth(context.Context, *registry.Service, bool) error {
+	return errors.New("not implemented")
+}
+
+func (s *staticRegistry) SubscribeEvents(string, func([]registry.ServiceEvent)) (registry.CancelFunc, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *staticRegistry) Subscribe(_ string, callback func([]*registry.Service)) (registry.CancelFunc, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.callbacks = append(s.callbacks, callback)
+	callback(s.services)
+	return func() {}, nil
+}
+
+func startServer(t *testing.T, opts ...grpc.ServerOption) *registry.Service {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &registry.Service{Name: "health", Addr: addr.IP.String(), Port: addr.Port}
+}
+
+func TestWeightedResolver(t *testing.T) {
+	heavy, light := startServer(t), startServer(t)
+	heavy.Weight = 3
+	reg := &staticRegistry{services: []*registry.Service{heavy, light}}
+
+	conn, err := grpc.NewClient(Scheme+":///health",
+		grpc.WithResolvers(NewBuilder(reg)),
+		grpc.WithDefaultServiceConfig(WeightedServiceConfig),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	call := func() string {
+		var p peer.Peer
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p)); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		return p.Addr.String()
+	}
+
+	// 等待两个连接都就绪，picker 只包含就绪的连接
+	seen := make(map[string]bool)
+	for deadline := time.Now().Add(5 * time.Second); len(seen) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("only reached %v", seen)
+		}
+		seen[call()] = true
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[call()]++
+	}
+	if counts[heavy.Endpoint()] != 30 || counts[light.Endpoint()] != 10 {
+		t.Fatalf("distribution = %v, want 30/10", counts)
+	}
+}
+
+// selfSignedCert 生成 localhost 的自签名证书
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestResolverTLS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	svc := startServer(t, grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	reg := &staticRegistry{services: []*registry.Service{svc}}
+
+	// 证书签发给 localhost 而不是服务名 health，由调用方通过 WithAuthority 指定校验的主机名
+	conn, err := grpc.NewClient(Scheme+":///health",
+		grpc.WithResolvers(NewBuilder(reg)),
+		grpc.WithAuthority("localhost"),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool})),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("Check over TLS: %v", err)
+	}
+}
+
+// recordingConn 记录解析器推送的状态
+type recordingConn struct {
+	resolver.ClientConn
+	state resolver.State
+}
+
+func (c *recordingConn) UpdateState(state resolver.State) error {
+	c.state = state
+	return nil
+}
+
+func TestResolverAddresses(t *testing.T) {
+	svc := &registry.Service{Name: "order", Addr: "10.0.0.1", Port: 8080}
+	cc := &recordingConn{}
+	r, err := NewBuilder(&staticRegistry{services: []*registry.Service{svc}}).Build(
+		resolver.Target{URL: url.URL{Scheme: Scheme, Path: "/order"}}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer r.Close()
+	if len(cc.state.Addresses) != 1 {
+		t.Fatalf("addresses = %v", cc.state.Addresses)
+	}
+	addr := cc.state.Addresses[0]
+	if addr.Addr != "10.0.0.1:8080" || addr.ServerName != "" {
+		t.Fatalf("address = %+v, want 10.0.0.1:8080 without ServerName", addr)
+	}
+	if got, ok := ServiceFromAddress(addr); !ok || got != svc {
+		t.Fatalf("ServiceFromAddress = %v, %v", got, ok)
+	}
+}
+
+func TestServiceAttr(t *testing.T) {
+	a := &registry.Service{Name: "svc", Addr: "10.0.0.1", Port: 80, Weight: 2, LastHeartbeat: time.Now()}
+	b := *a
+	b.LastHeartbeat = b.LastHeartbeat.Add(time.Second)
+	if !(serviceAttr{svc: a}).Equal(serviceAttr{svc: &b}) {
+		t.Fatalf("heartbeat refresh must not change the address")
+	}
+	b.Weight = 5
+	if (serviceAttr{svc: a}).Equal(serviceAttr{svc: &b}) {
+		t.Fatalf("weight change must change the address")
+	}
+}
@@ -0,0 +1,343 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lwm-galactic/logger"
+)
+
+// 健康检查的默认参数
+const (
+	defaultCheckInterval    = 10 * time.Second
+	defaultCheckTimeout     = 2 * time.Second
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 1
+	markHealthTimeout       = 5 * time.Second
+)
+
+// HealthCheck 注册方声明的健康检查，随实例一起保存在注册中心
+// HTTP、TCP、Custom 只使用其中一个，按此顺序优先
+type HealthCheck struct {
+	HTTP   string `json:"http,omitempty"`   // GET 该地址，返回 2xx 视为健康；以 / 开头时拼接实例的 addr:port
+	TCP    string `json:"tcp,omitempty"`    // 能建立 TCP 连接视为健康；以 : 开头时使用实例的 addr
+	Custom string `json:"custom,omitempty"` // 检查方通过 WithProbe 注册的探针名
+
+	Interval         time.Duration `json:"interval,omitempty"`          // 检查间隔，默认 10s
+	Timeout          time.Duration `json:"timeout,omitempty"`           // 单次检查超时，默认 2s
+	FailureThreshold int           `json:"failure_threshold,omitempty"` // 连续失败多少次标记为不健康，默认 3
+	SuccessThreshold int           `json:"success_threshold,omitempty"` // 连续成功多少次恢复为健康，默认 1
+}
+
+// withDefaults 返回补全默认值的副本
+func (h HealthCheck) withDefaults() HealthCheck {
+	if h.Interval <= 0 {
+		h.Interval = defaultCheckInterval
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = defaultCheckTimeout
+	}
+	if h.FailureThreshold <= 0 {
+		h.FailureThreshold = defaultFailureThreshold
+	}
+	if h.SuccessThreshold <= 0 {
+		h.SuccessThreshold = defaultSuccessThreshold
+	}
+	return h
+}
+
+// Probe 检查实例是否健康，返回 nil 表示健康
+type Probe func(ctx context.Context, svc *Service) error
+
+// HTTPProbe GET target，返回 2xx 视为健康；target 以 / 开头时拼接实例的 addr:port
+func HTTPProbe(target string) Probe {
+	return func(ctx context.Context, svc *Service) error {
+		url := target
+		if strings.HasPrefix(url, "/") {
+			url = "http://" + svc.Endpoint() + url
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("health check %s: status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// TCPProbe 能与 addr 建立 TCP 连接视为健康；addr 以 : 开头时使用实例的 addr
+func TCPProbe(addr string) Probe {
+	return func(ctx context.Context, svc *Service) error {
+		target := addr
+		if strings.HasPrefix(target, ":") {
+			target = svc.Addr + target
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HealthChecker 执行实例声明的健康检查，并通过 Registry.MarkHealth 把结果写入实例元数据
+// 可以运行在服务发现方，也可以作为独立的检查进程；多个检查方同时运行时结果相同，写入是幂等的。
+// 实例被判定为不健康后仍保留在注册中心中，Discovery 和 gRPC 解析器会跳过它，恢复后重新加入。
+type HealthChecker struct {
+	registry Registry
+	probes   map[string]Probe
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex   sync.Mutex
+	watches map[string]*healthWatch
+	closed  bool
+}
+
+// HealthCheckerOption HealthChecker 配置函数
+type HealthCheckerOption func(*HealthChecker)
+
+// WithProbe 注册自定义探针，实例通过 HealthCheck.Custom 引用
+func WithProbe(name string, probe Probe) HealthCheckerOption {
+	return func(c *HealthChecker) {
+		c.probes[name] = probe
+	}
+}
+
+// NewHealthChecker 创建健康检查器
+func NewHealthChecker(registry Registry, opts ...HealthCheckerOption) *HealthChecker {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &HealthChecker{
+		registry: registry,
+		probes:   make(map[string]Probe),
+		ctx:      ctx,
+		cancel:   cancel,
+		watches:  make(map[string]*healthWatch),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Watch 订阅服务，对声明了 HealthCheck 的实例定期检查，重复调用不会重复订阅
+func (c *HealthChecker) Watch(name string) error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrRegistryClosed
+	}
+	if _, ok := c.watches[name]; ok {
+		c.mutex.Unlock()
+		return nil
+	}
+	w := &healthWatch{checker: c, targets: make(map[string]*healthTarget)}
+	c.watches[name] = w
+	c.mutex.Unlock()
+
+	// 订阅时会同步回调，不能持有 c.mutex
+	cancel, err := c.registry.Subscribe(name, w.update)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil || c.closed {
+		delete(c.watches, name)
+		if cancel != nil {
+			cancel()
+		}
+		w.stop()
+		if err == nil {
+			err = ErrRegistryClosed
+		}
+		return err
+	}
+	w.cancel = cancel
+	return nil
+}
+
+// Close 取消所有订阅并停止检查
+func (c *HealthChecker) Close() {
+	c.mutex.Lock()
+	c.closed = true
+	watches := c.watches
+	c.watches = make(map[string]*healthWatch)
+	c.mutex.Unlock()
+
+	for _, w := range watches {
+		if w.cancel != nil {
+			w.cancel()
+		}
+		w.stop()
+	}
+	c.cancel()
+	c.wg.Wait()
+}
+
+// probe 按声明选择探针
+func (c *HealthChecker) probe(check HealthCheck) (Probe, error) {
+	switch {
+	case check.HTTP != "":
+		return HTTPProbe(check.HTTP), nil
+	case check.TCP != "":
+		return TCPProbe(check.TCP), nil
+	case check.Custom != "":
+		probe, ok := c.probes[check.Custom]
+		if !ok {
+			return nil, fmt.Errorf("unknown probe %q", check.Custom)
+		}
+		return probe, nil
+	default:
+		return nil, errors.New("health check declares no probe")
+	}
+}
+
+// healthWatch 一个服务下所有实例的检查
+type healthWatch struct {
+	checker *HealthChecker
+	cancel  CancelFunc
+
+	mutex   sync.Mutex
+	targets map[string]*healthTarget // 实例 ID -> 检查
+	stopped bool
+}
+
+// update 订阅回调，为新实例启动检查，停止已下线实例的检查
+func (w *healthWatch) update(services []*Service) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stopped {
+		return
+	}
+	seen := make(map[string]struct{}, len(services))
+	for _, svc := range services {
+		if svc.Check == nil {
+			continue
+		}
+		id := svc.instanceID()
+		seen[id] = struct{}{}
+		if t, ok := w.targets[id]; ok {
+			if *t.check == *svc.Check {
+				t.set(svc)
+				continue
+			}
+			// 检查声明变化，重新开始
+			t.cancel()
+		}
+		w.targets[id] = w.checker.start(svc)
+	}
+	for id, t := range w.targets {
+		if _, ok := seen[id]; !ok {
+			t.cancel()
+			delete(w.targets, id)
+		}
+	}
+}
+
+func (w *healthWatch) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stopped = true
+	for _, t := range w.targets {
+		t.cancel()
+	}
+	w.targets = nil
+}
+
+// healthTarget 单个实例的检查
+type healthTarget struct {
+	check  *HealthCheck
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	svc   *Service // 最新的实例信息，用于读取当前写入的健康状态
+}
+
+func (t *healthTarget) set(svc *Service) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.svc = svc
+}
+
+func (t *healthTarget) get() *Service {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.svc
+}
+
+func (c *HealthChecker) start(svc *Service) *healthTarget {
+	ctx, cancel := context.WithCancel(c.ctx)
+	t := &healthTarget{check: svc.Check, cancel: cancel, svc: svc}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(ctx, t)
+	}()
+	return t
+}
+
+// run 定期执行探针，连续失败或成功达到阈值后修改实例的健康状态
+// 每次检查后都与注册中心中的状态比较，实例重新注册覆盖了状态时会再次写入
+func (c *HealthChecker) run(ctx context.Context, t *healthTarget) {
+	check := t.check.withDefaults()
+	probe, err := c.probe(check)
+	if err != nil {
+		logger.Errorf("health check of %s err: %v", t.get().instanceID(), err)
+		return
+	}
+	healthy := t.get().IsHealthy()
+	failures, successes := 0, 0
+	ticker := time.NewTicker(check.Interval)
+	defer ticker.Stop()
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, check.Timeout)
+		probeErr := probe(probeCtx, t.get())
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if probeErr != nil {
+			failures, successes = failures+1, 0
+			if failures >= check.FailureThreshold {
+				healthy = false
+			}
+		} else {
+			failures, successes = 0, successes+1
+			if successes >= check.SuccessThreshold {
+				healthy = true
+			}
+		}
+
+		if svc := t.get(); svc.IsHealthy() != healthy {
+			markCtx, cancel := context.WithTimeout(ctx, markHealthTimeout)
+			err := c.registry.MarkHealth(markCtx, svc, healthy)
+			cancel()
+			switch {
+			case err == nil:
+				logger.Infof("mark %s/%s healthy=%v, probe err: %v", svc.Name, svc.instanceID(), healthy, probeErr)
+			case !errors.Is(err, ErrServiceNotFound) && ctx.Err() == nil:
+				logger.Errorf("mark health of %s/%s err: %v", svc.Name, svc.instanceID(), err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthyInstances(t *testing.T) {
+	services := newInstances(3)
+	if got := HealthyInstances(services); len(got) != 3 {
+		t.Fatalf("got %d healthy instances, want 3", len(got))
+	}
+	services[1].setHealth(false)
+	got := HealthyInstances(services)
+	if len(got) != 2 || got[0] != services[0] || got[1] != services[2] {
+		t.Fatalf("HealthyInstances = %v", got)
+	}
+	if len(services) != 3 || services[1].IsHealthy() {
+		t.Fatalf("input should not be modified")
+	}
+	services[1].setHealth(true)
+	if _, ok := services[1].Metadata[MetadataHealth]; ok {
+		t.Fatalf("recovery should remove the health metadata")
+	}
+}
+
+func TestProbes(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	svc := &Service{Name: "web", Addr: host}
+	svc.Port, _ = net.LookupPort("tcp", port)
+
+	ctx := context.Background()
+	if err := HTTPProbe("/healthz")(ctx, svc); err != nil {
+		t.Fatalf("HTTPProbe: %v", err)
+	}
+	if err := HTTPProbe(server.URL+"/healthz")(ctx, svc); err != nil {
+		t.Fatalf("HTTPProbe with full url: %v", err)
+	}
+	status.Store(http.StatusServiceUnavailable)
+	if err := HTTPProbe("/healthz")(ctx, svc); err == nil {
+		t.Fatalf("HTTPProbe should fail on 503")
+	}
+
+	if err := TCPProbe(":"+port)(ctx, svc); err != nil {
+		t.Fatalf("TCPProbe: %v", err)
+	}
+	server.Close()
+	if err := TCPProbe(":"+port)(ctx, svc); err == nil {
+		t.Fatalf("TCPProbe should fail after the server is closed")
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	reg := NewMemoryRegistry()
+	defer reg.Close()
+	var failing atomic.Bool
+	checker := NewHealthChecker(reg.Peer(), WithProbe("flag", func(context.Context, *Service) error {
+		if failing.Load() {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}))
+	defer checker.Close()
+
+	check := &HealthCheck{Custom: "flag", Interval: 10 * time.Millisecond, FailureThreshold: 2}
+	for i, id := range []string{"a", "b"} {
+		svc := &Service{ID: id, Name: "order", Addr: "127.0.0.1", Port: 8000 + i, TTL: time.Second, Check: check}
+		if id == "b" {
+			// 不声明健康检查的实例不受影响
+			svc.Check = nil
+		}
+		if err := reg.Register(context.Background(), svc); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	if err := checker.Watch("order"); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	d := NewDiscovery(reg.Peer())
+	defer d.Close()
+	strategy := RoundRobinStrategy()
+	picked := func() map[string]bool {
+		ids := make(map[string]bool)
+		for i := 0; i < 20; i++ {
+			svc, err := d.Pick(context.Background(), "order", strategy)
+			if err != nil {
+				t.Fatalf("Pick: %v", err)
+			}
+			ids[svc.ID] = true
+		}
+		return ids
+	}
+	waitFor := func(desc string, cond func(map[string]bool) bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(picked()); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", desc)
+			}
+		}
+	}
+
+	waitFor("both instances", func(ids map[string]bool) bool { return ids["a"] && ids["b"] })
+	failing.Store(true)
+	waitFor("unhealthy instance to be skipped", func(ids map[string]bool) bool { return !ids["a"] && ids["b"] })
+	if n := len(d.Instances("order")); n != 2 {
+		t.Fatalf("unhealthy instance should stay registered, got %d instances", n)
+	}
+	failing.Store(false)
+	waitFor("recovered instance to come back", func(ids map[string]bool) bool { return ids["a"] && ids["b"] })
+}
@@ -0,0 +1,189 @@
+// Package etcdtest 在测试进程内启动嵌入式 etcd，测试不再依赖外部 etcd 集群
+package etcdtest
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startTimeout 等待 etcd 就绪的最长时间
+const startTimeout = 30 * time.Second
+
+// Server 嵌入式 etcd 单节点集群
+type Server struct {
+	// Endpoints 客户端访问地址
+	Endpoints []string
+
+	etcd *embed.Etcd
+}
+
+// Start 在临时目录中启动 etcd，监听随机端口，测试结束时自动关闭
+func Start(t testing.TB) *Server {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Name = "etcdtest"
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "fatal"
+	cfg.UnsafeNoFsync = true
+	// 端口为 0 时由系统分配，启动后从监听器读取实际地址
+	local := url.URL{Scheme: "http", Host: "127.0.0.1:0"}
+	cfg.ListenClientUrls = []url.URL{local}
+	cfg.AdvertiseClientUrls = []url.URL{local}
+	cfg.ListenPeerUrls = []url.URL{local}
+	cfg.AdvertisePeerUrls = []url.URL{local}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("start embedded etcd: %v", err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case err := <-e.Err():
+		t.Fatalf("embedded etcd: %v", err)
+	case <-time.After(startTimeout):
+		t.Fatalf("embedded etcd not ready after %s", startTimeout)
+	}
+
+	s := &Server{etcd: e}
+	for _, l := range e.Clients {
+		s.Endpoints = append(s.Endpoints, l.Addr().String())
+	}
+	return s
+}
+
+// Client 创建连接到该 etcd 的客户端，测试结束时自动关闭
+func (s *Server) Client(t testing.TB) *clientv3.Client {
+	t.Helper()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   s.Endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("connect embedded etcd: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// Proxy 转发到 etcd 的 TCP 代理，用于模拟网络中断
+type Proxy struct {
+	// Endpoints 通过代理访问 etcd 的地址
+	Endpoints []string
+
+	target   string
+	listener net.Listener
+
+	mutex  sync.Mutex
+	conns  map[net.Conn]struct{}
+	paused bool
+}
+
+// Proxy 在随机端口启动转发到 etcd 的代理，测试结束时自动关闭
+func (s *Server) Proxy(t testing.TB) *Proxy {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	p := &Proxy{
+		Endpoints: []string{l.Addr().String()},
+		target:    s.Endpoints[0],
+		listener:  l,
+		conns:     make(map[net.Conn]struct{}),
+	}
+	go p.serve()
+	t.Cleanup(func() {
+		_ = l.Close()
+		p.Pause()
+	})
+	return p
+}
+
+// Client 创建通过代理连接 etcd 的客户端，测试结束时自动关闭
+func (p *Proxy) Client(t testing.TB) *clientv3.Client {
+	t.Helper()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   p.Endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("connect proxy: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// Pause 断开所有连接，恢复之前新的连接会被立即关闭
+func (p *Proxy) Pause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = true
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+}
+
+// Resume 恢复转发
+func (p *Proxy) Resume() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = false
+}
+
+func (p *Proxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.forward(conn)
+	}
+}
+
+func (p *Proxy) forward(conn net.Conn) {
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	p.mutex.Lock()
+	if p.paused {
+		p.mutex.Unlock()
+		_ = conn.Close()
+		_ = upstream.Close()
+		return
+	}
+	p.conns[conn] = struct{}{}
+	p.conns[upstream] = struct{}{}
+	p.mutex.Unlock()
+
+	// 任一方向结束时关闭两端
+	var once sync.Once
+	closeBoth := func() {
+		_ = conn.Close()
+		_ = upstream.Close()
+		p.mutex.Lock()
+		delete(p.conns, conn)
+		delete(p.conns, upstream)
+		p.mutex.Unlock()
+	}
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		once.Do(closeBoth)
+	}()
+	_, _ = io.Copy(conn, upstream)
+	once.Do(closeBoth)
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/lwm-galactic/logger"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// RegistrationState 服务注册状态
+type RegistrationState int
+
+const (
+	// StateRegistered 首次注册成功
+	StateRegistered RegistrationState = iota + 1
+	// StateLeaseLost 租约丢失（过期或被撤销），key 已从 etcd 中消失，即将重新注册
+	StateLeaseLost
+	// StateReregistered 租约丢失后重新注册成功
+	StateReregistered
+	// StateReregisterFailed 一次重新注册失败，退避后继续重试
+	StateReregisterFailed
+	// StateDeregistered 已注销，不再续约
+	StateDeregistered
+)
+
+// String 返回状态名称
+func (s RegistrationState) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateLeaseLost:
+		return "lease-lost"
+	case StateReregistered:
+		return "reregistered"
+	case StateReregisterFailed:
+		return "reregister-failed"
+	case StateDeregistered:
+		return "deregistered"
+	default:
+		return "unknown"
+	}
+}
+
+// RegistrationEvent 服务注册状态变化事件
+type RegistrationEvent struct {
+	Service *Service
+	State   RegistrationState
+	Err     error // StateReregisterFailed 时为失败原因
+	Time    time.Time
+}
+
+const (
+	minReregisterBackoff = time.Second
+	maxReregisterBackoff = 30 * time.Second
+	unregisterTimeout    = 5 * time.Second
+)
+
+// registration 一个已注册服务的续约协程
+// svc 是注册时的副本，leaseID 只由续约协程修改，协程退出后才能读取
+type registration struct {
+	svc     *Service
+	leaseID clientv3.LeaseID
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// keepAlive 使用流式 KeepAlive 续约，租约丢失时重新申请租约并写入 key，ctx 结束时注销服务
+func (r *EtcdRegistry) keepAlive(ctx context.Context, reg *registration) {
+	defer close(reg.done)
+	svc := reg.svc
+	backoff := minReregisterBackoff
+	for {
+		ch, err := r.client.KeepAlive(ctx, reg.leaseID)
+		if err == nil {
+			// 租约过期、被撤销或 ctx 结束时通道关闭；etcd 短暂不可用时客户端会在 TTL 内自动重试
+			for range ch {
+			}
+		}
+		if ctx.Err() != nil {
+			r.stopKeepAlive(reg)
+			return
+		}
+		logger.Errorf("lease of %s lost: %v", svc.buildServerKey(r.prefix), err)
+		r.emit(svc, StateLeaseLost, nil)
+
+		for {
+			select {
+			case <-ctx.Done():
+				r.stopKeepAlive(reg)
+				return
+			case <-time.After(backoff):
+			}
+			svc.LastHeartbeat = time.Now()
+			registerCtx, cancel := context.WithTimeout(ctx, svc.TTL)
+			leaseID, err := r.registerService(registerCtx, svc)
+			cancel()
+			if err == nil {
+				reg.leaseID = leaseID
+				break
+			}
+			logger.Errorf("reregister %s err: %v", svc.buildServerKey(r.prefix), err)
+			r.emit(svc, StateReregisterFailed, err)
+			backoff = min(backoff*2, maxReregisterBackoff)
+		}
+		backoff = minReregisterBackoff
+		r.emit(svc, StateReregistered, nil)
+	}
+}
+
+// stopKeepAlive 续约协程因 ctx 结束而退出
+// 如果是 Unregister 取消的，由 Unregister 负责清理；否则是 Register 的 ctx 结束，在这里注销服务
+func (r *EtcdRegistry) stopKeepAlive(reg *registration) {
+	key := reg.svc.buildServerKey(r.prefix)
+	r.mutex.Lock()
+	owned := r.registrations[key] == reg
+	if owned {
+		delete(r.registrations, key)
+	}
+	r.mutex.Unlock()
+	if !owned {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	if err := r.deleteService(ctx, reg.svc, reg.leaseID); err != nil {
+		logger.Errorf("unregister err: %v", err)
+	}
+}
+
+func (r *EtcdRegistry) emit(svc *Service, state RegistrationState, err error) {
+	if r.onEvent != nil {
+		r.onEvent(RegistrationEvent{Service: svc, State: state, Err: err, Time: time.Now()})
+	}
+}
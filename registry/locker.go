@@ -2,56 +2,256 @@ package registry
 
 import (
 	"context"
-	"github.com/lwm-galactic/logger"
+	"errors"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
-	"time"
 )
 
+// ErrLocked 锁已被其他持有者占用，TryLock 不等待直接返回
+var ErrLocked = errors.New("lock is held by another owner")
+
 // Locker 分布式锁接口
 type Locker interface {
-	// Acquire 加锁，带上下文用于超时/取消控制，返回是否成功和错误信息
-	Acquire(ctx context.Context, key string) (bool, error)
-	// Release 解锁
+	// Lock 阻塞直到获得 key 上的锁，ctx 结束时放弃等待并返回 ctx 的错误
+	Lock(ctx context.Context, key string) (Lock, error)
+	// TryLock 尝试获得 key 上的锁，已被占用时立即返回 ErrLocked
+	TryLock(ctx context.Context, key string) (Lock, error)
+}
+
+// Lock 已获得的锁，持有期间自动续约
+type Lock interface {
+	// Key 锁的 key
+	Key() string
+	// Token fencing token，同一个 key 上后获得锁的持有者得到更大的值
+	// 写入受保护的资源时带上该值，资源方拒绝比已见过的更小的 token，避免锁失效后的旧持有者写入
+	Token() int64
+	// Lost 锁意外失去时关闭，例如续约失败导致租约过期、锁的 key 被删除；调用 Release 后不会关闭
+	Lost() <-chan struct{}
+	// Release 释放锁
 	Release(ctx context.Context) error
 }
 
+// LockOptions 锁的配置
+type LockOptions struct {
+	// 锁的过期时间，持有期间自动续约；进程崩溃后最多经过该时长锁被自动释放
+	TTL time.Duration
+
+	// 以下配置只用于 Redis 锁，etcd 锁通过 watch 等待释放，不需要轮询
+	// 锁被占用时 Lock 重试的初始间隔，每次失败后翻倍，直到 MaxRetryInterval
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// Lock 最多重试的次数，<= 0 时一直重试到 ctx 结束
+	MaxRetries int
+	// 续约间隔，<= 0 时为 TTL/3
+	WatchdogInterval time.Duration
+}
+
+// LockOption 锁的配置函数
+type LockOption func(*LockOptions)
+
+// WithLockTTL 设置锁的过期时间，etcd 中按秒取整，最小 1s
+func WithLockTTL(ttl time.Duration) LockOption {
+	return func(o *LockOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithLockRetry 设置 Lock 重试的初始间隔和最大间隔
+func WithLockRetry(interval, maxInterval time.Duration) LockOption {
+	return func(o *LockOptions) {
+		o.RetryInterval = interval
+		o.MaxRetryInterval = maxInterval
+	}
+}
+
+// WithLockMaxRetries 设置 Lock 最多重试的次数
+func WithLockMaxRetries(n int) LockOption {
+	return func(o *LockOptions) {
+		o.MaxRetries = n
+	}
+}
+
+// WithWatchdogInterval 设置续约间隔
+func WithWatchdogInterval(interval time.Duration) LockOption {
+	return func(o *LockOptions) {
+		o.WatchdogInterval = interval
+	}
+}
+
+// NewLockOptions 创建锁的配置，默认过期时间 15s，重试间隔 50ms 到 1s
+func NewLockOptions(opts ...LockOption) *LockOptions {
+	options := &LockOptions{
+		TTL:              15 * time.Second,
+		RetryInterval:    50 * time.Millisecond,
+		MaxRetryInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// EtcdLocker 基于 etcd concurrency.Mutex 的分布式锁
+// 每把锁使用独立的 session（租约），由 session 自动续约，释放锁时撤销租约。
 type EtcdLocker struct {
-	session *concurrency.Session
-	mutex   *concurrency.Mutex
-	client  *clientv3.Client
-	key     string
+	client *clientv3.Client
+	ttl    int // 租约秒数
+}
+
+// NewEtcdLocker 基于已有的 etcd 客户端创建分布式锁，不会关闭该客户端
+func NewEtcdLocker(client *clientv3.Client, opts ...LockOption) *EtcdLocker {
+	options := NewLockOptions(opts...)
+	return &EtcdLocker{
+		client: client,
+		ttl:    max(int(options.TTL/time.Second), 1),
+	}
+}
+
+// Lock 阻塞直到获得锁或 ctx 结束
+func (l *EtcdLocker) Lock(ctx context.Context, key string) (Lock, error) {
+	return l.acquire(ctx, key, (*concurrency.Mutex).Lock)
+}
+
+// TryLock 尝试获得锁，已被占用时返回 ErrLocked
+func (l *EtcdLocker) TryLock(ctx context.Context, key string) (Lock, error) {
+	lock, err := l.acquire(ctx, key, (*concurrency.Mutex).TryLock)
+	if errors.Is(err, concurrency.ErrLocked) {
+		return nil, ErrLocked
+	}
+	return lock, err
 }
 
-func NewEtcdLocker(client *clientv3.Client, key string, ttl int) (*EtcdLocker, error) {
-	session, err := concurrency.NewSession(client, concurrency.WithTTL(ttl))
+func (l *EtcdLocker) acquire(ctx context.Context, key string, lock func(*concurrency.Mutex, context.Context) error) (Lock, error) {
+	// session 的生命周期跟随锁而不是 ctx，ctx 只控制申请租约和等待锁
+	session, err := concurrency.NewSession(l.client, concurrency.WithTTL(l.ttl))
 	if err != nil {
 		return nil, err
 	}
-
 	mutex := concurrency.NewMutex(session, key)
-	return &EtcdLocker{
+	if err := lock(mutex, ctx); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	el := &etcdLock{
+		client:  l.client,
 		session: session,
 		mutex:   mutex,
-		client:  client,
 		key:     key,
-	}, nil
+		token:   mutex.Header().Revision,
+		lost:    make(chan struct{}),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go el.monitor(monitorCtx)
+	return el, nil
 }
 
-func (l *EtcdLocker) Acquire(ctx context.Context, key string) (bool, error) {
-	logger.Infof("Trying to acquire lock for %s\n", key)
+// etcdLock 持有中的 etcd 锁
+type etcdLock struct {
+	client  *clientv3.Client
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+	key     string
+	token   int64
 
-	// 使用上下文控制超时
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	lost   chan struct{}
+	cancel context.CancelFunc // 停止 monitor
+	done   chan struct{}      // monitor 退出后关闭
+	once   sync.Once
+}
 
-	err := l.mutex.Lock(ctxWithTimeout)
-	if err != nil {
-		return false, err
+func (l *etcdLock) Key() string {
+	return l.key
+}
+
+func (l *etcdLock) Token() int64 {
+	return l.token
+}
+
+func (l *etcdLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release 删除锁的 key 并撤销租约，重复调用直接返回 nil
+func (l *etcdLock) Release(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		l.cancel()
+		<-l.done
+		// 停止自动续约，由这里撤销租约以便使用调用方的 ctx
+		l.session.Orphan()
+		err = l.mutex.Unlock(ctx)
+		// 锁已经失去时租约可能已不存在
+		_, revokeErr := l.client.Revoke(ctx, l.session.Lease())
+		if revokeErr != nil && !errors.Is(revokeErr, rpctypes.ErrLeaseNotFound) && err == nil {
+			err = revokeErr
+		}
+	})
+	return err
+}
+
+// monitor 监听 session 和锁的 key，session 失效或 key 被删除时关闭 lost
+func (l *etcdLock) monitor(ctx context.Context) {
+	defer close(l.done)
+	rev := l.token
+	for {
+		if l.watch(ctx, rev) {
+			close(l.lost)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// watch 中断（例如历史版本已被压缩），确认 key 仍然存在后从当前版本重新监听
+		// key 名包含 session 的租约 ID，存在即说明锁仍由自己持有
+		resp, err := l.client.Get(ctx, l.mutex.Key())
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil && len(resp.Kvs) == 0:
+			close(l.lost)
+			return
+		case err == nil:
+			rev = resp.Header.Revision
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.session.Done():
+			close(l.lost)
+			return
+		case <-time.After(time.Second):
+		}
 	}
-	return true, nil
 }
 
-func (l *EtcdLocker) Release(ctx context.Context) error {
-	return l.mutex.Unlock(context.Background())
+// watch 从 rev 之后监听锁的 key，返回锁是否失去；watch 中断或 ctx 结束时返回 false
+func (l *etcdLock) watch(ctx context.Context, rev int64) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := l.client.Watch(ctx, l.mutex.Key(), clientv3.WithRev(rev+1))
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-l.session.Done():
+			return true
+		case resp, ok := <-ch:
+			if !ok || resp.Err() != nil {
+				return false
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == clientv3.EventTypeDelete {
+					return true
+				}
+			}
+		}
+	}
 }
@@ -0,0 +1,180 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/internal/etcdtest"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestEtcdLocker(t *testing.T) {
+	server := etcdtest.Start(t)
+	first := registry.NewEtcdLocker(server.Client(t), registry.WithLockTTL(5*time.Second))
+	second := registry.NewEtcdLocker(server.Client(t), registry.WithLockTTL(5*time.Second))
+
+	ctx := context.Background()
+	held, err := first.Lock(ctx, "/locks/job")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if held.Key() != "/locks/job" {
+		t.Fatalf("Key = %s", held.Key())
+	}
+
+	// 锁被持有时，TryLock 立即返回，Lock 等到 ctx 超时
+	if _, err := second.TryLock(ctx, "/locks/job"); !errors.Is(err, registry.ErrLocked) {
+		t.Fatalf("TryLock while locked = %v, want ErrLocked", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := second.Lock(timeout, "/locks/job"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock while locked = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Lock should honour the ctx deadline, took %v", elapsed)
+	}
+	// 不同的 key 互不影响
+	other, err := second.TryLock(ctx, "/locks/other")
+	if err != nil {
+		t.Fatalf("TryLock other key: %v", err)
+	}
+	if err := other.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	// 释放后等待中的 Lock 获得锁，token 递增
+	acquired := make(chan registry.Lock, 1)
+	go func() {
+		lock, err := second.Lock(ctx, "/locks/job")
+		if err != nil {
+			t.Errorf("Lock: %v", err)
+		}
+		acquired <- lock
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("Lock returned before Release")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := held.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	select {
+	case next := <-acquired:
+		if next == nil {
+			t.FailNow()
+		}
+		if next.Token() <= held.Token() {
+			t.Fatalf("token %d should be greater than %d", next.Token(), held.Token())
+		}
+		if err := next.Release(ctx); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lock did not get the lock after Release")
+	}
+	select {
+	case <-held.Lost():
+		t.Fatalf("Release should not close Lost")
+	default:
+	}
+}
+
+func TestEtcdLockerMutualExclusion(t *testing.T) {
+	server := etcdtest.Start(t)
+	locker := registry.NewEtcdLocker(server.Client(t))
+
+	// 同一个加锁器在多个协程中加锁同样互斥
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		holders int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := locker.Lock(context.Background(), "/locks/counter")
+			if err != nil {
+				t.Errorf("Lock: %v", err)
+				return
+			}
+			mutex.Lock()
+			holders++
+			if holders > 1 {
+				t.Errorf("%d holders at the same time", holders)
+			}
+			mutex.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mutex.Lock()
+			holders--
+			mutex.Unlock()
+			if err := lock.Release(context.Background()); err != nil {
+				t.Errorf("Release: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEtcdLockerRenewAndLost(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	locker := registry.NewEtcdLocker(client, registry.WithLockTTL(time.Second))
+	ctx := context.Background()
+
+	lock, err := locker.Lock(ctx, "/locks/job")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	// 持有时间超过 TTL，租约自动续约
+	time.Sleep(2500 * time.Millisecond)
+	select {
+	case <-lock.Lost():
+		t.Fatalf("lock should be renewed while held")
+	default:
+	}
+	if _, err := locker.TryLock(ctx, "/locks/job"); !errors.Is(err, registry.ErrLocked) {
+		t.Fatalf("TryLock = %v, want ErrLocked", err)
+	}
+
+	// 锁的 key 被删除后通知失去锁
+	if _, err := client.Delete(ctx, "/locks/job/", clientv3.WithPrefix()); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lost should be closed after the key is deleted")
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release after lost: %v", err)
+	}
+
+	// 租约被撤销后同样通知失去锁
+	lock, err = locker.Lock(ctx, "/locks/job")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	resp, err := client.Get(ctx, "/locks/job/", clientv3.WithPrefix())
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("Get = %v, %v", resp, err)
+	}
+	if _, err := client.Revoke(ctx, clientv3.LeaseID(resp.Kvs[0].Lease)); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lost should be closed after the lease is revoked")
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release after lost: %v", err)
+	}
+}
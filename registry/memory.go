@@ -0,0 +1,337 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRegistry 进程内的注册中心，用于单元测试和单机开发
+// 服务注册后一直有效，直到调用 Unregister、Register 的 ctx 结束或 Close。
+// 通过 Peer 可以得到共享同一份数据的多个实例，模拟多个节点。
+type MemoryRegistry struct {
+	store   *memoryStore
+	onEvent func(RegistrationEvent)
+
+	mutex  sync.Mutex
+	owned  map[string]*memoryRegistration // 本实例注册的服务，key 为 服务名/实例 ID
+	subs   map[*memoryWatch]struct{}
+	closed bool
+}
+
+// NewMemoryRegistry 创建进程内注册中心，只使用 Options 中的 RegistrationHandler
+func NewMemoryRegistry(opts ...Option) *MemoryRegistry {
+	return newMemoryRegistry(&memoryStore{
+		services: make(map[string]map[string]*Service),
+		watches:  make(map[string]map[*memoryWatch]struct{}),
+	}, NewOptions(opts...))
+}
+
+func newMemoryRegistry(store *memoryStore, opt *Options) *MemoryRegistry {
+	return &MemoryRegistry{
+		store:   store,
+		onEvent: opt.RegistrationHandler,
+		owned:   make(map[string]*memoryRegistration),
+		subs:    make(map[*memoryWatch]struct{}),
+	}
+}
+
+// Peer 返回共享同一份数据的另一个注册中心实例，各实例独立注册和关闭
+func (m *MemoryRegistry) Peer(opts ...Option) *MemoryRegistry {
+	return newMemoryRegistry(m.store, NewOptions(opts...))
+}
+
+// Register 注册服务，ctx 结束时自动注销
+func (m *MemoryRegistry) Register(ctx context.Context, svc *Service) error {
+	if err := svc.prepare(time.Now()); err != nil {
+		return err
+	}
+	key := svc.Name + "/" + svc.instanceID()
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return ErrRegistryClosed
+	}
+	if old := m.owned[key]; old != nil {
+		old.stop()
+	}
+	reg := &memoryRegistration{}
+	reg.stop = context.AfterFunc(ctx, func() {
+		m.mutex.Lock()
+		owned := m.owned[key] == reg
+		if owned {
+			delete(m.owned, key)
+		}
+		m.mutex.Unlock()
+		if owned && m.store.remove(svc.Name, svc.instanceID()) {
+			m.emit(svc, StateDeregistered)
+		}
+	})
+	m.owned[key] = reg
+	// 在锁内写入，避免与 Close 交错导致实例在关闭后残留
+	m.store.put(svc.clone())
+	m.mutex.Unlock()
+
+	m.emit(svc, StateRegistered)
+	return nil
+}
+
+// Unregister 注销服务
+func (m *MemoryRegistry) Unregister(_ context.Context, svc *Service) error {
+	id := svc.instanceID()
+	key := svc.Name + "/" + id
+	m.mutex.Lock()
+	if reg := m.owned[key]; reg != nil {
+		reg.stop()
+	}
+	delete(m.owned, key)
+	m.mutex.Unlock()
+	if m.store.remove(svc.Name, id) {
+		m.emit(svc, StateDeregistered)
+	}
+	return nil
+}
+
+// MarkHealth 修改实例的健康状态
+func (m *MemoryRegistry) MarkHealth(_ context.Context, svc *Service, healthy bool) error {
+	return m.store.markHealth(svc.Name, svc.instanceID(), healthy)
+}
+
+// Subscribe 订阅服务的完整实例列表，返回前同步回调一次当前列表
+func (m *MemoryRegistry) Subscribe(name string, callback func([]*Service)) (CancelFunc, error) {
+	return m.SubscribeEvents(name, listHandler(callback))
+}
+
+// SubscribeEvents 订阅服务实例的增量变化，返回前同步回调一次当前所有实例
+// 之后的事件在单独的协程中按顺序回调
+func (m *MemoryRegistry) SubscribeEvents(name string, handler func([]ServiceEvent)) (CancelFunc, error) {
+	w := &memoryWatch{handler: handler, done: make(chan struct{})}
+	w.cond = sync.NewCond(&w.mutex)
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil, ErrRegistryClosed
+	}
+	initial := m.store.watch(name, w)
+	m.subs[w] = struct{}{}
+	m.mutex.Unlock()
+
+	// 初始回调完成后才开始投递后续事件，保证顺序
+	handler(initial)
+	go w.run()
+
+	return func() {
+		m.store.unwatch(name, w)
+		w.stop()
+		m.mutex.Lock()
+		delete(m.subs, w)
+		m.mutex.Unlock()
+	}, nil
+}
+
+// Close 注销本实例注册的所有服务并取消所有订阅
+func (m *MemoryRegistry) Close() error {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil
+	}
+	m.closed = true
+	owned, subs := m.owned, m.subs
+	m.owned, m.subs = make(map[string]*memoryRegistration), make(map[*memoryWatch]struct{})
+	m.mutex.Unlock()
+
+	m.unregister(owned)
+	for w := range subs {
+		m.store.unwatchAll(w)
+		w.stop()
+	}
+	return nil
+}
+
+// UnregisterAll 注销本实例注册的所有服务，注册中心仍可继续使用
+func (m *MemoryRegistry) UnregisterAll(context.Context) error {
+	m.mutex.Lock()
+	owned := m.owned
+	m.owned = make(map[string]*memoryRegistration)
+	m.mutex.Unlock()
+
+	m.unregister(owned)
+	return nil
+}
+
+// unregister 停止 ctx 的监听并删除 owned 中的服务
+func (m *MemoryRegistry) unregister(owned map[string]*memoryRegistration) {
+	for _, reg := range owned {
+		reg.stop()
+	}
+	for _, svc := range m.store.removeOwned(owned) {
+		m.emit(svc, StateDeregistered)
+	}
+}
+
+func (m *MemoryRegistry) emit(svc *Service, state RegistrationState) {
+	if m.onEvent != nil {
+		m.onEvent(RegistrationEvent{Service: svc, State: state, Time: time.Now()})
+	}
+}
+
+// memoryRegistration 一个已注册的服务
+type memoryRegistration struct {
+	stop func() bool // 停止监听 Register 的 ctx
+}
+
+// memoryStore 多个 MemoryRegistry 共享的数据
+type memoryStore struct {
+	mutex    sync.Mutex
+	services map[string]map[string]*Service // 服务名 -> 实例 ID -> 实例
+	watches  map[string]map[*memoryWatch]struct{}
+}
+
+func (s *memoryStore) put(svc *Service) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	instances := s.services[svc.Name]
+	if instances == nil {
+		instances = make(map[string]*Service)
+		s.services[svc.Name] = instances
+	}
+	id := svc.instanceID()
+	typ := EventAdded
+	if _, ok := instances[id]; ok {
+		typ = EventUpdated
+	}
+	instances[id] = svc
+	s.notify(svc.Name, ServiceEvent{Type: typ, Service: svc})
+}
+
+func (s *memoryStore) remove(name, id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	svc, ok := s.services[name][id]
+	if !ok {
+		return false
+	}
+	delete(s.services[name], id)
+	s.notify(name, ServiceEvent{Type: EventRemoved, Service: svc})
+	return true
+}
+
+// markHealth 替换为修改了健康状态的副本，已发出的实例不会被修改
+func (s *memoryStore) markHealth(name, id string, healthy bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	svc, ok := s.services[name][id]
+	if !ok {
+		return ErrServiceNotFound
+	}
+	updated := svc.clone()
+	if !updated.setHealth(healthy) {
+		return nil
+	}
+	s.services[name][id] = updated
+	s.notify(name, ServiceEvent{Type: EventUpdated, Service: updated})
+	return nil
+}
+
+// removeOwned 删除 owned 中的所有实例，返回被删除的实例
+func (s *memoryStore) removeOwned(owned map[string]*memoryRegistration) []*Service {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var removed []*Service
+	for name, instances := range s.services {
+		for id, svc := range instances {
+			if _, ok := owned[name+"/"+id]; ok {
+				delete(instances, id)
+				s.notify(name, ServiceEvent{Type: EventRemoved, Service: svc})
+				removed = append(removed, svc)
+			}
+		}
+	}
+	return removed
+}
+
+// watch 登记订阅并返回当前所有实例的 EventAdded 事件
+func (s *memoryStore) watch(name string, w *memoryWatch) []ServiceEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.watches[name] == nil {
+		s.watches[name] = make(map[*memoryWatch]struct{})
+	}
+	s.watches[name][w] = struct{}{}
+
+	events := make([]ServiceEvent, 0, len(s.services[name]))
+	for _, svc := range s.services[name] {
+		events = append(events, ServiceEvent{Type: EventAdded, Service: svc})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Service.instanceID() < events[j].Service.instanceID()
+	})
+	return events
+}
+
+func (s *memoryStore) unwatch(name string, w *memoryWatch) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.watches[name], w)
+}
+
+func (s *memoryStore) unwatchAll(w *memoryWatch) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, watches := range s.watches {
+		delete(watches, w)
+	}
+}
+
+func (s *memoryStore) notify(name string, e ServiceEvent) {
+	for w := range s.watches[name] {
+		w.push(e)
+	}
+}
+
+// memoryWatch 一个订阅的事件队列，在独立协程中按顺序回调，避免回调阻塞写操作
+type memoryWatch struct {
+	handler func([]ServiceEvent)
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   []ServiceEvent
+	stopped bool
+	done    chan struct{}
+}
+
+func (w *memoryWatch) push(e ServiceEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.queue = append(w.queue, e)
+	w.cond.Signal()
+}
+
+func (w *memoryWatch) run() {
+	defer close(w.done)
+	for {
+		w.mutex.Lock()
+		for len(w.queue) == 0 && !w.stopped {
+			w.cond.Wait()
+		}
+		if w.stopped {
+			w.mutex.Unlock()
+			return
+		}
+		events := w.queue
+		w.queue = nil
+		w.mutex.Unlock()
+		w.handler(events)
+	}
+}
+
+// stop 停止回调并等待协程退出
+func (w *memoryWatch) stop() {
+	w.mutex.Lock()
+	w.stopped = true
+	w.cond.Signal()
+	w.mutex.Unlock()
+	<-w.done
+}
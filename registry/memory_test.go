@@ -0,0 +1,19 @@
+package registry_test
+
+import (
+	"testing"
+
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/registrytest"
+)
+
+var _ registry.Registry = (*registry.MemoryRegistry)(nil)
+
+func TestMemoryRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registrytest.NewRegistry {
+		root := registry.NewMemoryRegistry()
+		return func() registry.Registry {
+			return root.Peer()
+		}
+	})
+}
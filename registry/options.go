@@ -5,12 +5,18 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/spf13/pflag"
+	"strings"
 	"time"
 )
 
 // Options 配置中心的配置.
 type Options struct {
 
+	// 服务注册的 key 前缀
+	Prefix string `json:"prefix" mapstructure:"prefix"`
+	// 命名空间，例如按环境区分 dev、prod，为空时直接注册在 Prefix 下
+	Namespace string `json:"namespace" mapstructure:"namespace"`
+
 	// 必填项 - etcd 集群节点地址
 	Endpoints []string `json:"endpoints" mapstructure:"endpoints"`
 	// 连接超时时间
@@ -30,6 +36,12 @@ type Options struct {
 
 	// 上下文配置
 	Context context.Context // 控制客户端生命周期的上下文
+
+	// 仅用于 Redis 注册中心：订阅方全量扫描的间隔，用于发现过期的实例和丢失的通知，etcd 注册中心忽略该项
+	RedisResyncInterval time.Duration `json:"redis-resync-interval" mapstructure:"redis-resync-interval"`
+
+	// 注册状态变化的回调，在续约协程中同步调用，不能阻塞
+	RegistrationHandler func(RegistrationEvent) `json:"-" mapstructure:"-"`
 }
 
 // Option 配置函数类型
@@ -39,12 +51,14 @@ type Option func(*Options)
 func NewOptions(opts ...Option) *Options {
 	// 设置默认值
 	options := &Options{
-		Endpoints:          []string{"localhost:2379"},
-		DialTimeout:        5 * time.Second,
-		DialKeepAliveTime:  30 * time.Second,
-		MaxCallSendMsgSize: 2 * 1024 * 1024, // 2MB
-		MaxCallRecvMsgSize: 4 * 1024 * 1024, // 4MB
-		Context:            context.Background(),
+		Prefix:              "/services",
+		Endpoints:           []string{"localhost:2379"},
+		DialTimeout:         5 * time.Second,
+		DialKeepAliveTime:   30 * time.Second,
+		MaxCallSendMsgSize:  2 * 1024 * 1024, // 2MB
+		MaxCallRecvMsgSize:  4 * 1024 * 1024, // 4MB
+		Context:             context.Background(),
+		RedisResyncInterval: 5 * time.Second,
 	}
 
 	// 应用配置函数
@@ -55,6 +69,20 @@ func NewOptions(opts ...Option) *Options {
 	return options
 }
 
+// WithPrefix 设置服务注册的 key 前缀
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithNamespace 设置命名空间，不同命名空间的服务互不可见
+func WithNamespace(namespace string) Option {
+	return func(o *Options) {
+		o.Namespace = namespace
+	}
+}
+
 // WithEndpoints 设置 etcd 集群地址
 func WithEndpoints(endpoints []string) Option {
 	return func(o *Options) {
@@ -112,24 +140,57 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// WithRedisResyncInterval 设置 Redis 注册中心订阅方的全量扫描间隔，只对 Redis 注册中心生效
+func WithRedisResyncInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.RedisResyncInterval = interval
+	}
+}
+
+// WithRegistrationHandler 设置注册状态变化的回调
+func WithRegistrationHandler(handler func(RegistrationEvent)) Option {
+	return func(o *Options) {
+		o.RegistrationHandler = handler
+	}
+}
+
 // Validate rpc 的启动配置校验
 func (s *Options) Validate() []error {
 	var errors []error
 
-	if len(s.Endpoints) < 0 {
+	if len(s.Endpoints) == 0 {
 		errors = append(
 			errors,
 			fmt.Errorf("at least one endpoint is required"),
 		)
 	}
 
+	if s.Context == nil {
+		errors = append(errors, fmt.Errorf("context must not be nil"))
+	}
+
 	return errors
 }
 
+// keyPrefix 返回实际使用的 key 前缀，去掉末尾的 /
+func (s *Options) keyPrefix() string {
+	prefix := strings.TrimSuffix(s.Prefix, "/")
+	if s.Namespace != "" {
+		prefix += "/" + strings.Trim(s.Namespace, "/")
+	}
+	return prefix
+}
+
 // AddFlags adds flags related to features for a specific api server to the
 // specified FlagSet.
 
 func (s *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.Prefix, "etcd.prefix", s.Prefix,
+		"Key prefix under which services are registered")
+
+	fs.StringVar(&s.Namespace, "etcd.namespace", s.Namespace,
+		"Namespace appended to the prefix, e.g. the environment name")
+
 	fs.StringSliceVar(&s.Endpoints, "etcd.endpoints", s.Endpoints,
 		"Comma-separated list of etcd endpoints (e.g., http://172.16.0.10:2379)")
 
@@ -0,0 +1,23 @@
+package registry
+
+import "testing"
+
+func TestKeyPrefix(t *testing.T) {
+	cases := []struct {
+		opts []Option
+		want string
+	}{
+		{nil, "/services"},
+		{[]Option{WithPrefix("/svc/")}, "/svc"},
+		{[]Option{WithNamespace("prod")}, "/services/prod"},
+		{[]Option{WithPrefix("/svc"), WithNamespace("/dev/")}, "/svc/dev"},
+	}
+	for _, c := range cases {
+		if got := NewOptions(c.opts...).keyPrefix(); got != c.want {
+			t.Errorf("keyPrefix = %q, want %q", got, c.want)
+		}
+	}
+	if errs := NewOptions(WithEndpoints(nil)).Validate(); len(errs) == 0 {
+		t.Errorf("empty endpoints should fail validation")
+	}
+}
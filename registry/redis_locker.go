@@ -0,0 +1,395 @@
+package registry
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lwm-galactic/tools/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Redis 锁的数据布局：
+//
+//	<key>            加锁时 SET NX PX 写入的随机值，只有持有者能续约和删除
+//	{<key>}:fencing  每次加锁成功后 INCR，作为 fencing token；用 hash tag 与锁放在同一个 Cluster slot
+//
+// Redlock 模式下各实例的计数器互相独立，获得锁后把多数实例上的计数器抬高到取得的 token，
+// 任意两个多数派至少有一个公共实例，之后的持有者在该实例上 INCR 得到的值必然更大。
+
+const fencingSuffix = ":fencing"
+
+var (
+	// acquireScript 加锁成功时递增并返回 fencing token，锁被占用时返回 0
+	acquireScript = goredis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0`)
+
+	// raiseScript 仍持有锁时把 fencing 计数器抬高到 ARGV[2]，返回是否仍持有锁
+	raiseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if current < tonumber(ARGV[2]) then
+	redis.call("SET", KEYS[2], ARGV[2])
+end
+return 1`)
+
+	// unlockScript 值与自己的随机值相同时才删除，避免删除锁过期后被其他持有者获得的锁
+	unlockScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	// renewScript 值与自己的随机值相同时才刷新过期时间
+	renewScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// RedisLocker 基于 Redis 的分布式锁
+// 只有一个客户端时是普通的 SET NX PX 锁；有多个相互独立的 Redis 实例时按 Redlock 算法，
+// 在超过半数的实例上加锁成功且耗时小于 TTL 才算获得锁。
+type RedisLocker struct {
+	clients     []goredis.UniversalClient
+	ownsClients bool
+	quorum      int
+	options     *LockOptions
+}
+
+// NewRedisLocker 基于已有的 Redis 客户端创建分布式锁，不会关闭该客户端
+func NewRedisLocker(client goredis.UniversalClient, opts ...LockOption) *RedisLocker {
+	return NewRedlock([]goredis.UniversalClient{client}, opts...)
+}
+
+// NewRedlock 基于多个相互独立的 Redis 实例创建 Redlock 锁，不会关闭这些客户端
+// 实例之间不能是主从或同一个集群，否则故障切换时可能有多个持有者
+func NewRedlock(clients []goredis.UniversalClient, opts ...LockOption) *RedisLocker {
+	return &RedisLocker{
+		clients: clients,
+		quorum:  len(clients)/2 + 1,
+		options: NewLockOptions(opts...),
+	}
+}
+
+// NewRedisLockerFromConfig 通过 redis 包为每个配置创建客户端，多个配置时使用 Redlock，Close 时关闭这些客户端
+func NewRedisLockerFromConfig(configs []*redis.Config, opts ...LockOption) *RedisLocker {
+	clients := make([]goredis.UniversalClient, 0, len(configs))
+	for _, config := range configs {
+		clients = append(clients, redis.NewRedisClusterPool(false, config))
+	}
+	l := NewRedlock(clients, opts...)
+	l.ownsClients = true
+	return l
+}
+
+// Lock 阻塞直到获得锁
+// 锁被占用或 Redis 出错时按退避间隔重试，直到 ctx 结束或达到 MaxRetries
+func (l *RedisLocker) Lock(ctx context.Context, key string) (Lock, error) {
+	backoff := l.options.RetryInterval
+	for attempt := 1; ; attempt++ {
+		lock, err := l.TryLock(ctx, key)
+		if err == nil {
+			return lock, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if l.options.MaxRetries > 0 && attempt > l.options.MaxRetries {
+			return nil, err
+		}
+		// 在 [backoff/2, backoff] 之间随机等待，避免多个等待者同时重试
+		wait := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, l.options.MaxRetryInterval)
+	}
+}
+
+// TryLock 在所有实例上尝试加锁一次，未达到多数时释放已加上的锁并返回 ErrLocked
+func (l *RedisLocker) TryLock(ctx context.Context, key string) (Lock, error) {
+	value, err := randomValue()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	results := make([]acquireResult, len(l.clients))
+	var wg sync.WaitGroup
+	for i, client := range l.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].acquired, results[i].token, results[i].err = l.acquire(ctx, client, key, value)
+		}()
+	}
+	wg.Wait()
+
+	var (
+		acquired int
+		token    int64
+		errs     []error
+	)
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+		}
+		if r.acquired {
+			acquired++
+			token = max(token, r.token)
+		}
+	}
+	if acquired >= l.quorum && len(l.clients) > 1 {
+		var raiseErrs []error
+		acquired, raiseErrs = l.raise(ctx, key, value, token, results)
+		errs = append(errs, raiseErrs...)
+	}
+	// 扣除加锁耗时和各实例之间的时钟漂移，剩余时间不足时视为失败
+	drift := l.options.TTL/100 + 2*time.Millisecond
+	if acquired >= l.quorum && time.Since(start)+drift < l.options.TTL {
+		return l.newLock(key, value, token), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unregisterTimeout)
+	defer cancel()
+	l.unlock(ctx, key, value)
+	// 没有实例返回锁被占用，失败全部由错误导致
+	if len(errs) > 0 && len(errs)+acquired == len(l.clients) {
+		return nil, errors.Join(errs...)
+	}
+	return nil, ErrLocked
+}
+
+// Close 关闭通过 NewRedisLockerFromConfig 创建的客户端，已获得的锁不会被释放
+func (l *RedisLocker) Close() error {
+	if !l.ownsClients {
+		return nil
+	}
+	var errs []error
+	for _, client := range l.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// acquireResult 一个实例上的加锁结果
+type acquireResult struct {
+	acquired bool
+	token    int64
+	err      error
+}
+
+// acquire 在一个实例上加锁并递增 fencing token，两步在一个脚本中原子完成
+func (l *RedisLocker) acquire(ctx context.Context, client goredis.UniversalClient, key, value string) (bool, int64, error) {
+	token, err := acquireScript.Run(ctx, client, []string{key, fencingKey(key)}, value, l.options.TTL.Milliseconds()).Int64()
+	if err != nil || token == 0 {
+		return false, 0, err
+	}
+	return true, token, nil
+}
+
+// raise 把加锁成功的实例上的 fencing 计数器抬高到 token，返回仍持有锁并抬高成功的实例数
+// 只有在多数实例上抬高成功，之后任意多数派上获得的 token 才一定更大
+func (l *RedisLocker) raise(ctx context.Context, key, value string, token int64, results []acquireResult) (int, []error) {
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		raised int
+		errs   []error
+	)
+	for i, client := range l.clients {
+		if !results[i].acquired {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			held, err := raiseScript.Run(ctx, client, []string{key, fencingKey(key)}, value, token).Int()
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			raised += held
+		}()
+	}
+	wg.Wait()
+	return raised, errs
+}
+
+// unlock 在所有实例上删除自己的锁，返回执行成功的实例数
+func (l *RedisLocker) unlock(ctx context.Context, key, value string) (int, []error) {
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		success int
+		errs    []error
+	)
+	for _, client := range l.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := unlockScript.Run(ctx, client, []string{key}, value).Err()
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			success++
+		}()
+	}
+	wg.Wait()
+	return success, errs
+}
+
+// renew 在所有实例上刷新过期时间，返回仍持有锁的实例数和确认已失去锁的实例数
+func (l *RedisLocker) renew(ctx context.Context, key, value string) (held, lost int) {
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+	)
+	for _, client := range l.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := renewScript.Run(ctx, client, []string{key}, value, l.options.TTL.Milliseconds()).Int()
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch {
+			case err != nil:
+				// 无法确认，等待下次续约
+			case n == 1:
+				held++
+			default:
+				lost++
+			}
+		}()
+	}
+	wg.Wait()
+	return held, lost
+}
+
+func (l *RedisLocker) newLock(key, value string, token int64) *redisLock {
+	ctx, cancel := context.WithCancel(context.Background())
+	lock := &redisLock{
+		locker: l,
+		key:    key,
+		value:  value,
+		token:  token,
+		lost:   make(chan struct{}),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go lock.watchdog(ctx)
+	return lock
+}
+
+// redisLock 持有中的 Redis 锁
+type redisLock struct {
+	locker *RedisLocker
+	key    string
+	value  string // 加锁时写入的随机值
+	token  int64
+
+	lost   chan struct{}
+	cancel context.CancelFunc // 停止 watchdog
+	done   chan struct{}      // watchdog 退出后关闭
+	once   sync.Once
+}
+
+func (l *redisLock) Key() string {
+	return l.key
+}
+
+func (l *redisLock) Token() int64 {
+	return l.token
+}
+
+func (l *redisLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release 停止续约并删除锁，多数实例执行失败时返回错误，重复调用直接返回 nil
+func (l *redisLock) Release(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		l.cancel()
+		<-l.done
+		success, errs := l.locker.unlock(ctx, l.key, l.value)
+		if success < l.locker.quorum {
+			err = errors.Join(errs...)
+		}
+	})
+	return err
+}
+
+// watchdog 定期续约
+// 多数实例确认锁已不属于自己，或者距离上次成功续约已超过 TTL 时关闭 lost
+func (l *redisLock) watchdog(ctx context.Context) {
+	defer close(l.done)
+	options := l.locker.options
+	interval := options.WatchdogInterval
+	if interval <= 0 {
+		interval = options.TTL / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewCtx, cancel := context.WithTimeout(ctx, interval)
+		start := time.Now()
+		held, lost := l.locker.renew(renewCtx, l.key, l.value)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if held >= l.locker.quorum {
+			renewed = start
+			continue
+		}
+		if lost > len(l.locker.clients)-l.locker.quorum || time.Since(renewed) >= options.TTL {
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// fencingKey 返回 fencing 计数器的 key，与锁的 key 落在同一个 Cluster slot
+// key 中已有 hash tag 时直接追加后缀，否则用整个 key 作为 hash tag
+func fencingKey(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 && strings.IndexByte(key[start+1:], '}') > 0 {
+		return key + fencingSuffix
+	}
+	return "{" + key + "}" + fencingSuffix
+}
+
+// randomValue 生成锁的随机值，用于区分持有者
+func randomValue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
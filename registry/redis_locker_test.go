@@ -0,0 +1,196 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lwm-galactic/tools/registry"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	_ registry.Locker = (*registry.RedisLocker)(nil)
+	_ registry.Locker = (*registry.EtcdLocker)(nil)
+)
+
+func newRedisClient(t *testing.T, server *miniredis.Miniredis) goredis.UniversalClient {
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+func TestRedisLocker(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := registry.NewRedisLocker(newRedisClient(t, server), registry.WithLockRetry(10*time.Millisecond, 50*time.Millisecond))
+	second := registry.NewRedisLocker(newRedisClient(t, server), registry.WithLockRetry(10*time.Millisecond, 50*time.Millisecond))
+
+	ctx := context.Background()
+	held, err := first.Lock(ctx, "locks:job")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if _, err := second.TryLock(ctx, "locks:job"); !errors.Is(err, registry.ErrLocked) {
+		t.Fatalf("TryLock while locked = %v, want ErrLocked", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := second.Lock(timeout, "locks:job"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock while locked = %v, want DeadlineExceeded", err)
+	}
+	limited := registry.NewRedisLocker(newRedisClient(t, server), registry.WithLockMaxRetries(2),
+		registry.WithLockRetry(time.Millisecond, time.Millisecond))
+	if _, err := limited.Lock(ctx, "locks:job"); !errors.Is(err, registry.ErrLocked) {
+		t.Fatalf("Lock with max retries = %v, want ErrLocked", err)
+	}
+
+	// 释放后等待中的 Lock 获得锁，token 递增
+	acquired := make(chan registry.Lock, 1)
+	go func() {
+		lock, err := second.Lock(ctx, "locks:job")
+		if err != nil {
+			t.Errorf("Lock: %v", err)
+		}
+		acquired <- lock
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := held.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	var next registry.Lock
+	select {
+	case next = <-acquired:
+		if next == nil {
+			t.FailNow()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lock did not get the lock after Release")
+	}
+	if next.Token() <= held.Token() {
+		t.Fatalf("token %d should be greater than %d", next.Token(), held.Token())
+	}
+
+	// 旧持有者重复释放不会删除新持有者的锁
+	if err := held.Release(ctx); err != nil {
+		t.Fatalf("second Release: %v", err)
+	}
+	if !server.Exists("locks:job") {
+		t.Fatalf("Release must not delete a lock held by another owner")
+	}
+	if err := next.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if server.Exists("locks:job") {
+		t.Fatalf("lock should be deleted after Release")
+	}
+}
+
+func TestRedisLockerWatchdog(t *testing.T) {
+	server := miniredis.RunT(t)
+	locker := registry.NewRedisLocker(newRedisClient(t, server),
+		registry.WithLockTTL(time.Second), registry.WithWatchdogInterval(20*time.Millisecond))
+
+	ctx := context.Background()
+	lock, err := locker.Lock(ctx, "locks:job")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	// miniredis 的过期时间只随 FastForward 流逝，续约后剩余时间恢复为 TTL
+	for i := 0; i < 3; i++ {
+		server.FastForward(800 * time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !server.Exists("locks:job") {
+		t.Fatalf("watchdog should keep the lock alive")
+	}
+	select {
+	case <-lock.Lost():
+		t.Fatalf("lock should not be lost while renewed")
+	default:
+	}
+
+	// 锁被删除后续约失败，通知失去锁
+	server.Del("locks:job")
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Lost should be closed after the lock is deleted")
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release after lost: %v", err)
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	servers := make([]*miniredis.Miniredis, 3)
+	clients := make([]goredis.UniversalClient, 3)
+	for i := range servers {
+		servers[i] = miniredis.RunT(t)
+		clients[i] = newRedisClient(t, servers[i])
+	}
+	locker := registry.NewRedlock(clients, registry.WithLockRetry(10*time.Millisecond, 50*time.Millisecond))
+	ctx := context.Background()
+
+	// 少数实例上的锁被其他持有者占用时仍能获得锁
+	servers[0].Set("locks:job", "other")
+	lock, err := locker.TryLock(ctx, "locks:job")
+	if err != nil {
+		t.Fatalf("TryLock with quorum: %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if v, _ := servers[0].Get("locks:job"); v != "other" {
+		t.Fatalf("Release must not delete the lock of another owner, got %q", v)
+	}
+
+	// 多数实例被占用时失败，并清理已经加上的锁
+	servers[1].Set("locks:job", "other")
+	if _, err := locker.TryLock(ctx, "locks:job"); !errors.Is(err, registry.ErrLocked) {
+		t.Fatalf("TryLock without quorum = %v, want ErrLocked", err)
+	}
+	if servers[2].Exists("locks:job") {
+		t.Fatalf("partial lock should be released")
+	}
+	servers[0].Del("locks:job")
+	servers[1].Del("locks:job")
+
+	// 各实例的计数器不同，在不同的多数派上加锁时 token 仍然递增
+	servers[0].Set("{locks:job}:fencing", "100")
+	var last int64
+	for _, busy := range []int{2, 0, 1, 2} {
+		servers[busy].Set("locks:job", "other")
+		lock, err := locker.TryLock(ctx, "locks:job")
+		if err != nil {
+			t.Fatalf("TryLock with instance %d busy: %v", busy, err)
+		}
+		if lock.Token() <= last {
+			t.Fatalf("token %d with instance %d busy should be greater than %d", lock.Token(), busy, last)
+		}
+		last = lock.Token()
+		if err := lock.Release(ctx); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		servers[busy].Del("locks:job")
+	}
+
+	// 一个实例不可用时仍能加锁和释放
+	servers[2].Close()
+	lock, err = locker.Lock(ctx, "locks:job")
+	if err != nil {
+		t.Fatalf("Lock with one instance down: %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release with one instance down: %v", err)
+	}
+
+	// 多数实例不可用时返回错误
+	servers[1].Close()
+	if _, err := locker.TryLock(ctx, "locks:job"); err == nil || errors.Is(err, registry.ErrLocked) {
+		t.Fatalf("TryLock with majority down = %v, want connection error", err)
+	}
+}
@@ -0,0 +1,534 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lwm-galactic/logger"
+	"github.com/lwm-galactic/tools/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Redis 注册中心的数据布局：
+//
+//	<prefix>/<name>/<id>  实例信息（JSON），带 TTL，续约时刷新过期时间
+//	<prefix>/<name>       pub/sub 通道，实例写入或删除时发布 redisEvent
+//
+// 过期不会产生通知，订阅方按 RedisResyncInterval 定期扫描全量 key 与本地状态比较，
+// 同时补上 pub/sub 中丢失的消息。
+
+// redisEvent pub/sub 通道中的消息
+type redisEvent struct {
+	Op      string          `json:"op"` // put 或 del
+	Key     string          `json:"key"`
+	Service json.RawMessage `json:"service,omitempty"`
+}
+
+const (
+	redisOpPut = "put"
+	redisOpDel = "del"
+)
+
+// RedisRegistry 基于 Redis 的注册中心
+type RedisRegistry struct {
+	prefix         string
+	client         goredis.UniversalClient
+	ownsClient     bool
+	onEvent        func(RegistrationEvent)
+	resyncInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex         sync.Mutex
+	registrations map[string]*registration
+	closed        bool
+}
+
+// NewRedisRegistry 基于已有的 Redis 客户端创建注册中心，Close 时不会关闭该客户端
+// 使用 Options 中的 Prefix、Namespace、RedisResyncInterval、RegistrationHandler 和 Context
+func NewRedisRegistry(client goredis.UniversalClient, opts ...Option) *RedisRegistry {
+	opt := NewOptions(opts...)
+	ctx, cancel := context.WithCancel(opt.Context)
+	return &RedisRegistry{
+		prefix:         opt.keyPrefix(),
+		client:         client,
+		onEvent:        opt.RegistrationHandler,
+		resyncInterval: opt.RedisResyncInterval,
+		ctx:            ctx,
+		cancel:         cancel,
+		registrations:  make(map[string]*registration),
+	}
+}
+
+// NewRedisRegistryFromConfig 通过 redis 包创建客户端并创建注册中心，Close 时关闭该客户端
+func NewRedisRegistryFromConfig(config *redis.Config, opts ...Option) *RedisRegistry {
+	r := NewRedisRegistry(redis.NewRedisClusterPool(false, config), opts...)
+	r.ownsClient = true
+	return r
+}
+
+// Register 写入实例信息并启动续约协程
+// key 因过期消失时自动重新写入，ctx 结束或调用 Unregister 后停止续约并注销
+func (r *RedisRegistry) Register(ctx context.Context, svc *Service) error {
+	key := svc.buildServerKey(r.prefix)
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return ErrRegistryClosed
+	}
+	old := r.registrations[key]
+	delete(r.registrations, key)
+	r.mutex.Unlock()
+	if old != nil {
+		old.cancel()
+		<-old.done
+	}
+
+	// 续约协程使用副本，调用方之后修改 svc 不会影响续约
+	if err := svc.prepare(time.Now()); err != nil {
+		return err
+	}
+	registered := svc.clone()
+	key = registered.buildServerKey(r.prefix)
+	value, err := registered.marshal()
+	if err != nil {
+		return err
+	}
+	if err := r.put(ctx, registered, key, value); err != nil {
+		return err
+	}
+	r.emit(registered, StateRegistered, nil)
+
+	keepAliveCtx, cancel := context.WithCancel(ctx)
+	reg := &registration{svc: registered, cancel: cancel, done: make(chan struct{})}
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		cancel()
+		_ = r.remove(context.Background(), registered)
+		return ErrRegistryClosed
+	}
+	r.registrations[key] = reg
+	r.wg.Add(1)
+	r.mutex.Unlock()
+
+	// 启动后台续约协程，Close 等待它退出后再关闭客户端
+	go func() {
+		defer r.wg.Done()
+		r.keepAlive(keepAliveCtx, registered, key, value, reg)
+	}()
+	return nil
+}
+
+// Unregister 停止续约并删除实例
+func (r *RedisRegistry) Unregister(ctx context.Context, svc *Service) error {
+	key := svc.buildServerKey(r.prefix)
+	r.mutex.Lock()
+	reg := r.registrations[key]
+	delete(r.registrations, key)
+	r.mutex.Unlock()
+	if reg != nil {
+		reg.cancel()
+		<-reg.done
+	}
+	return r.remove(ctx, svc)
+}
+
+// MarkHealth 修改实例的健康状态
+// 在 WATCH 事务中读取并写回，保留 key 的剩余过期时间
+func (r *RedisRegistry) MarkHealth(ctx context.Context, svc *Service, healthy bool) error {
+	key := svc.buildServerKey(r.prefix)
+	var value string
+	update := func(tx *goredis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, goredis.Nil) {
+			return ErrServiceNotFound
+		}
+		if err != nil {
+			return err
+		}
+		current, err := unmarshalService(data)
+		if err != nil {
+			return err
+		}
+		if !current.setHealth(healthy) {
+			return nil
+		}
+		if value, err = current.marshal(); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, value, goredis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		return err
+	}
+	for {
+		value = ""
+		err := r.client.Watch(ctx, update, key)
+		if errors.Is(err, goredis.TxFailedErr) {
+			// key 在读取后被修改，重新读取
+			continue
+		}
+		if err != nil || value == "" {
+			return err
+		}
+		return r.publish(ctx, svc.Name, redisEvent{Op: redisOpPut, Key: key, Service: json.RawMessage(value)})
+	}
+}
+
+// Subscribe 订阅服务的完整实例列表，返回前同步回调一次当前列表
+func (r *RedisRegistry) Subscribe(name string, callback func([]*Service)) (CancelFunc, error) {
+	return r.SubscribeEvents(name, listHandler(callback))
+}
+
+// SubscribeEvents 订阅服务实例的增量变化，返回前同步回调一次当前所有实例
+func (r *RedisRegistry) SubscribeEvents(name string, handler func([]ServiceEvent)) (CancelFunc, error) {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, ErrRegistryClosed
+	}
+	r.wg.Add(1)
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	// 先订阅通道再拉取全量，避免两者之间的变化丢失
+	pubsub := r.client.Subscribe(ctx, r.channel(name))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		cancel()
+		r.wg.Done()
+		return nil, err
+	}
+	w := &redisWatch{
+		registry: r,
+		pattern:  r.prefix + "/" + name + "/*",
+		handler:  handler,
+		state:    make(map[string]string),
+	}
+	if err := w.resync(ctx, true); err != nil {
+		_ = pubsub.Close()
+		cancel()
+		r.wg.Done()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer r.wg.Done()
+		defer close(done)
+		defer pubsub.Close()
+		w.run(ctx, pubsub.Channel())
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// UnregisterAll 停止续约并并发删除本实例注册的所有服务，注册中心仍可继续使用
+func (r *RedisRegistry) UnregisterAll(ctx context.Context) error {
+	r.mutex.Lock()
+	registrations := r.registrations
+	r.registrations = make(map[string]*registration)
+	r.mutex.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		errs  []error
+	)
+	for _, reg := range registrations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reg.cancel()
+			<-reg.done
+			if err := r.remove(ctx, reg.svc); err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close 删除本实例注册的所有服务，停止所有续约和订阅协程
+// 通过 NewRedisRegistryFromConfig 创建时同时关闭客户端
+func (r *RedisRegistry) Close() error {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	var errs []error
+	if err := r.UnregisterAll(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	r.cancel()
+	r.wg.Wait()
+	if r.ownsClient {
+		if err := r.client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RedisRegistry) channel(name string) string {
+	return r.prefix + "/" + name
+}
+
+// put 写入实例并发布通知
+func (r *RedisRegistry) put(ctx context.Context, svc *Service, key, value string) error {
+	if err := r.client.Set(ctx, key, value, svc.TTL).Err(); err != nil {
+		return err
+	}
+	return r.publish(ctx, svc.Name, redisEvent{Op: redisOpPut, Key: key, Service: json.RawMessage(value)})
+}
+
+// remove 删除实例并发布通知
+func (r *RedisRegistry) remove(ctx context.Context, svc *Service) error {
+	key := svc.buildServerKey(r.prefix)
+	n, err := r.client.Del(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if err := r.publish(ctx, svc.Name, redisEvent{Op: redisOpDel, Key: key}); err != nil {
+			return err
+		}
+	}
+	r.emit(svc, StateDeregistered, nil)
+	return nil
+}
+
+func (r *RedisRegistry) publish(ctx context.Context, name string, e redisEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel(name), data).Err()
+}
+
+// keepAlive 每 TTL/3 刷新一次过期时间，key 已经过期时重新写入
+func (r *RedisRegistry) keepAlive(ctx context.Context, svc *Service, key, value string, reg *registration) {
+	defer close(reg.done)
+	ticker := time.NewTicker(max(svc.TTL/3, 100*time.Millisecond))
+	defer ticker.Stop()
+	lost := false
+	for {
+		select {
+		case <-ctx.Done():
+			r.stopKeepAlive(svc, key, reg)
+			return
+		case <-ticker.C:
+		}
+		if !lost {
+			ok, err := r.client.PExpire(ctx, key, svc.TTL).Result()
+			if err != nil {
+				logger.Errorf("refresh %s err: %v", key, err)
+				continue
+			}
+			if ok {
+				continue
+			}
+			lost = true
+			r.emit(svc, StateLeaseLost, nil)
+		}
+		if err := r.put(ctx, svc, key, value); err != nil {
+			logger.Errorf("reregister %s err: %v", key, err)
+			r.emit(svc, StateReregisterFailed, err)
+			continue
+		}
+		lost = false
+		r.emit(svc, StateReregistered, nil)
+	}
+}
+
+// stopKeepAlive 续约协程因 ctx 结束而退出，如果不是 Unregister 或 Close 取消的，在这里注销服务
+func (r *RedisRegistry) stopKeepAlive(svc *Service, key string, reg *registration) {
+	r.mutex.Lock()
+	owned := r.registrations[key] == reg
+	if owned {
+		delete(r.registrations, key)
+	}
+	r.mutex.Unlock()
+	if !owned {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	if err := r.remove(ctx, svc); err != nil {
+		logger.Errorf("unregister err: %v", err)
+	}
+}
+
+func (r *RedisRegistry) emit(svc *Service, state RegistrationState, err error) {
+	if r.onEvent != nil {
+		r.onEvent(RegistrationEvent{Service: svc, State: state, Err: err, Time: time.Now()})
+	}
+}
+
+// redisWatch 一个订阅的本地状态
+type redisWatch struct {
+	registry *RedisRegistry
+	pattern  string
+	handler  func([]ServiceEvent)
+	state    map[string]string // key -> 实例 JSON
+}
+
+func (w *redisWatch) run(ctx context.Context, messages <-chan *goredis.Message) {
+	ticker := time.NewTicker(w.registry.resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var e redisEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				continue // 跳过无效数据
+			}
+			w.apply(e)
+		case <-ticker.C:
+			if err := w.resync(ctx, false); err != nil {
+				logger.Errorf("resync %s err: %v", w.pattern, err)
+			}
+		}
+	}
+}
+
+func (w *redisWatch) apply(e redisEvent) {
+	var event ServiceEvent
+	old, ok := w.state[e.Key]
+	switch e.Op {
+	case redisOpPut:
+		if ok && old == string(e.Service) {
+			return
+		}
+		svc, err := unmarshalService(e.Service)
+		if err != nil {
+			return
+		}
+		svc.LastHeartbeat = time.Now()
+		w.state[e.Key] = string(e.Service)
+		event = ServiceEvent{Type: EventAdded, Service: svc}
+		if ok {
+			event.Type = EventUpdated
+		}
+	case redisOpDel:
+		if !ok {
+			return
+		}
+		svc, err := unmarshalService([]byte(old))
+		if err != nil {
+			return
+		}
+		delete(w.state, e.Key)
+		event = ServiceEvent{Type: EventRemoved, Service: svc}
+	default:
+		return
+	}
+	w.handler([]ServiceEvent{event})
+}
+
+// resync 扫描全量 key，与本地状态比较后回调差异；first 为 true 时即使没有差异也回调
+func (w *redisWatch) resync(ctx context.Context, first bool) error {
+	current, err := w.scan(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var events []ServiceEvent
+	keys := make([]string, 0, len(current))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := current[key]
+		old, ok := w.state[key]
+		if ok && old == value {
+			continue
+		}
+		svc, err := unmarshalService([]byte(value))
+		if err != nil {
+			continue // 跳过无效数据
+		}
+		svc.LastHeartbeat = now
+		w.state[key] = value
+		if ok {
+			events = append(events, ServiceEvent{Type: EventUpdated, Service: svc})
+		} else {
+			events = append(events, ServiceEvent{Type: EventAdded, Service: svc})
+		}
+	}
+	for key, old := range w.state {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		delete(w.state, key)
+		if svc, err := unmarshalService([]byte(old)); err == nil {
+			events = append(events, ServiceEvent{Type: EventRemoved, Service: svc})
+		}
+	}
+	if first || len(events) > 0 {
+		w.handler(events)
+	}
+	return nil
+}
+
+// scan 读取所有匹配的 key 及其值，集群模式下扫描每个主节点
+func (w *redisWatch) scan(ctx context.Context) (map[string]string, error) {
+	result := make(map[string]string)
+	var mutex sync.Mutex
+	scanNode := func(ctx context.Context, client goredis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, w.pattern, 100).Iterator()
+		var keys []string
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, err := client.Get(ctx, key).Result()
+			if errors.Is(err, goredis.Nil) {
+				continue // 扫描之后过期
+			}
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			result[key] = value
+			mutex.Unlock()
+		}
+		return nil
+	}
+	if cluster, ok := w.registry.client.(*goredis.ClusterClient); ok {
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *goredis.Client) error {
+			return scanNode(ctx, client)
+		})
+		return result, err
+	}
+	return result, scanNode(ctx, w.registry.client)
+}
@@ -0,0 +1,92 @@
+package registry_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/registrytest"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var _ registry.Registry = (*registry.RedisRegistry)(nil)
+
+func newRedisBackend(t *testing.T) (*miniredis.Miniredis, registrytest.NewRegistry) {
+	server := miniredis.RunT(t)
+	return server, func() registry.Registry {
+		client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		return registry.NewRedisRegistry(client, registry.WithRedisResyncInterval(50*time.Millisecond))
+	}
+}
+
+func TestRedisRegistry(t *testing.T) {
+	registrytest.Run(t, func(t *testing.T) registrytest.NewRegistry {
+		_, newRegistry := newRedisBackend(t)
+		return newRegistry
+	})
+}
+
+func TestRedisRegistryExpiry(t *testing.T) {
+	server, newRegistry := newRedisBackend(t)
+	consumer := newRegistry()
+	defer consumer.Close()
+
+	var (
+		states  = make(chan registry.RegistrationState, 10)
+		removed = make(chan struct{}, 10)
+	)
+	cancel, err := consumer.SubscribeEvents("order", func(events []registry.ServiceEvent) {
+		for _, e := range events {
+			if e.Type == registry.EventRemoved {
+				removed <- struct{}{}
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("SubscribeEvents: %v", err)
+	}
+	defer cancel()
+
+	// 模拟进程崩溃后残留的实例：key 过期后订阅方通过定期扫描发现实例下线
+	svc := &registry.Service{ID: "order-1", Name: "order", Addr: "127.0.0.1", Port: 8001, TTL: time.Second}
+	value, _ := json.Marshal(svc)
+	server.Set("/services/order/order-1", string(value))
+	server.SetTTL("/services/order/order-1", time.Second)
+	time.Sleep(200 * time.Millisecond)
+	server.FastForward(2 * time.Second)
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expired instance was not removed")
+	}
+
+	// 续约中的实例被意外删除后会自动重新写入
+	producer := registry.NewRedisRegistry(goredis.NewClient(&goredis.Options{Addr: server.Addr()}),
+		registry.WithRegistrationHandler(func(e registry.RegistrationEvent) {
+			states <- e.State
+		}))
+	defer producer.Close()
+	if err := producer.Register(context.Background(), svc); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	server.Del("/services/order/order-1")
+	for _, want := range []registry.RegistrationState{registry.StateRegistered, registry.StateLeaseLost, registry.StateReregistered} {
+		select {
+		case got := <-states:
+			if got != want {
+				t.Fatalf("state = %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+	if !server.Exists("/services/order/order-1") {
+		t.Fatalf("instance should be written back")
+	}
+}
@@ -2,12 +2,11 @@ package registry
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/lwm-galactic/logger"
 
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"go.etcd.io/etcd/client/v3"
-	"log"
 	"sync"
 	"time"
 )
@@ -15,22 +14,36 @@ import (
 type Registry interface {
 	Register(ctx context.Context, svc *Service) error
 	Unregister(ctx context.Context, svc *Service) error
-	Subscribe(name string, callback func([]*Service)) error
+	// Subscribe 订阅服务的完整实例列表，返回前同步回调一次当前列表
+	Subscribe(name string, callback func([]*Service)) (CancelFunc, error)
+	// SubscribeEvents 订阅服务实例的增量变化，返回前同步回调一次当前所有实例
+	SubscribeEvents(name string, handler func([]ServiceEvent)) (CancelFunc, error)
+	// MarkHealth 修改实例元数据中的健康状态，实例可以由其他进程注册，不影响其租约
+	MarkHealth(ctx context.Context, svc *Service, healthy bool) error
 	Close() error
 }
 
 var (
-	registry Registry
-	once     sync.Once
+	// ErrRegistryClosed 注册中心已关闭
+	ErrRegistryClosed = errors.New("registry is closed")
+	// ErrServiceNotFound 实例不存在或已过期
+	ErrServiceNotFound = errors.New("service instance not found")
 )
 
+// EtcdRegistry 基于 etcd 的注册中心
+// 每个实例拥有独立的 etcd 客户端，服务注册在 <prefix>/<namespace>/<name>/<id> 下
 type EtcdRegistry struct {
-	prefix string
-	client *clientv3.Client
+	prefix  string
+	client  *clientv3.Client
+	onEvent func(RegistrationEvent)
 
-	// locker Locker
-	// subscribers map[string][]func([]*Service)
-	// strategies  map[string]Strategy
+	ctx    context.Context // Close 时取消，用于停止所有 watch
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // 运行中的 watch 和续约协程，Close 等待它们退出后再关闭客户端
+
+	mutex         sync.Mutex
+	registrations map[string]*registration // 续约中的服务，key 为服务在 etcd 中的 key
+	closed        bool
 }
 
 func newEtcdClient(options *Options) (*clientv3.Client, error) {
@@ -51,47 +64,58 @@ func newEtcdClient(options *Options) (*clientv3.Client, error) {
 	return cli, nil
 }
 
+// NewEtcdRegistry 创建注册中心，未设置的配置使用 NewOptions 中的默认值
+// 每次调用都会创建独立的实例，使用完毕后需要调用 Close
 func NewEtcdRegistry(opts ...Option) (Registry, error) {
-	if registry == nil {
-
+	opt := NewOptions(opts...)
+	if errs := opt.Validate(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
-	var e error
-	once.Do(func() {
-		opt := &Options{}
-		for _, o := range opts {
-			o(opt)
-		}
-		client, err := newEtcdClient(opt)
-		if err != nil {
-			e = err
-		}
-		registry = &EtcdRegistry{client: client}
-	})
-	if e != nil {
-		return nil, e
+	client, err := newEtcdClient(opt)
+	if err != nil {
+		return nil, err
 	}
-
-	return registry, nil
+	ctx, cancel := context.WithCancel(opt.Context)
+	return &EtcdRegistry{
+		prefix:        opt.keyPrefix(),
+		client:        client,
+		onEvent:       opt.RegistrationHandler,
+		ctx:           ctx,
+		cancel:        cancel,
+		registrations: make(map[string]*registration),
+	}, nil
 }
 
-func (r *EtcdRegistry) registerService(svc *Service) error {
+// registerService 申请租约并写入实例信息，返回租约 ID
+func (r *EtcdRegistry) registerService(ctx context.Context, svc *Service) (clientv3.LeaseID, error) {
 	serviceKey := svc.buildServerKey(r.prefix)
 
-	logger.Debugf("watch key: %s", serviceKey)
+	logger.Debugf("register key: %s", serviceKey)
 	// 步骤一：创建租约
-	leaseResp, err := r.client.Grant(context.Background(), int64(svc.TTL.Seconds()))
+	leaseResp, err := r.client.Grant(ctx, svc.leaseTTL())
 	if err != nil {
-		return err
+		return 0, err
+	}
+	// 步骤二：将服务信息序列化为 JSON
+	serviceValue, err := svc.marshal()
+	if err == nil {
+		// 步骤三：绑定租约并写入 etcd
+		_, err = r.client.Put(ctx, serviceKey, serviceValue, clientv3.WithLease(leaseResp.ID))
+	}
+	if err != nil {
+		// 写入失败时撤销租约，避免留下无人续约的租约；ctx 可能已经结束，使用新的 ctx
+		revokeCtx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+		defer cancel()
+		if _, revokeErr := r.client.Revoke(revokeCtx, leaseResp.ID); revokeErr != nil {
+			logger.Errorf("revoke lease of %s err: %v", serviceKey, revokeErr)
+		}
+		return 0, err
 	}
-	svc.leaseID = leaseResp.ID
-	// 步骤二：将服务信息序列化为 JSON（也可以用 protobuf）
-	serviceValue := fmt.Sprintf(`{"name":"%s","addr":"%s","port":%d}`, svc.Name, svc.Addr, svc.Port)
-	// 步骤三：绑定租约并写入 etcd
-	_, err = r.client.Put(context.Background(), serviceKey, serviceValue, clientv3.WithLease(svc.leaseID))
-	return err
+	return leaseResp.ID, nil
 }
 
-// Register 在注册时启动协程定期发送心跳
+// Register 注册服务并启动续约协程
+// 租约丢失时自动重新注册，ctx 结束或调用 Unregister 后停止续约并注销
 func (r *EtcdRegistry) Register(ctx context.Context, svc *Service) error {
 	/*
 		// 获取锁
@@ -110,123 +134,176 @@ func (r *EtcdRegistry) Register(ctx context.Context, svc *Service) error {
 				}
 			}(r.locker, ctx)
 	*/
-	// 注册服务逻辑
-	err := r.registerService(svc)
+	// 同一个 key 重复注册时，先停止旧的续约协程
+	key := svc.buildServerKey(r.prefix)
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return ErrRegistryClosed
+	}
+	old := r.registrations[key]
+	delete(r.registrations, key)
+	r.mutex.Unlock()
+	if old != nil {
+		old.cancel()
+		<-old.done
+	}
+
+	// 注册服务逻辑，续约协程使用副本，不会修改调用方的 svc
+	if err := svc.prepare(time.Now()); err != nil {
+		return err
+	}
+	registered := svc.clone()
+	leaseID, err := r.registerService(ctx, registered)
 	if err != nil {
 		return err
 	}
+	r.emit(registered, StateRegistered, nil)
 
-	// 启动后台心跳协程
-	go func() {
-		ticker := time.NewTicker(svc.TTL / 2)
-		defer ticker.Stop()
-		retryCount := 0
-		const maxRetries = 3 // 最大重试次数
-		for {
-			select {
-			case <-ticker.C:
-				var err2 error
-				for ; retryCount < maxRetries; retryCount++ {
-					_, err2 = r.client.KeepAliveOnce(context.Background(), svc.leaseID)
-					if err2 == nil {
-						retryCount = 0 // 成功后重置重试计数器
-						break
-					}
-
-					logger.Errorf("心跳失败，正在重试 (%d/%d): %v", retryCount+1, maxRetries, err2)
-					time.Sleep(time.Second * time.Duration(1<<uint(retryCount))) // 指数退避
-				}
+	keepAliveCtx, cancel := context.WithCancel(ctx)
+	reg := &registration{svc: registered, leaseID: leaseID, cancel: cancel, done: make(chan struct{})}
+	r.mutex.Lock()
+	if r.closed {
+		// 注册期间注册中心被关闭，Close 已经不会再清理这个服务
+		r.mutex.Unlock()
+		cancel()
+		_ = r.deleteService(context.Background(), registered, leaseID)
+		return ErrRegistryClosed
+	}
+	r.registrations[key] = reg
+	r.wg.Add(1)
+	r.mutex.Unlock()
 
-				if err2 != nil {
-					logger.Errorf("心跳失败超过最大重试次数: %v", err2)
-					// 可选：触发服务注销或重启逻辑
-					err = r.Unregister(ctx, svc)
-					if err != nil {
-						logger.Errorf("unregister err: %v", err)
-						return
-					}
-					return
-				}
-			case <-ctx.Done():
-				err = r.Unregister(ctx, svc)
-				if err != nil {
-					logger.Errorf("unregister err: %v", err)
-					return
-				}
-				return
-			}
-		}
+	// 启动后台续约协程，ctx 结束时自动注销
+	go func() {
+		defer r.wg.Done()
+		r.keepAlive(keepAliveCtx, reg)
 	}()
 	return nil
 }
 
+// Unregister 停止续约并注销服务
 func (r *EtcdRegistry) Unregister(ctx context.Context, svc *Service) error {
 	key := svc.buildServerKey(r.prefix)
-	_, err := r.client.Delete(ctx, key)
-	if err != nil {
-		return err
+	r.mutex.Lock()
+	reg := r.registrations[key]
+	delete(r.registrations, key)
+	r.mutex.Unlock()
+	if reg == nil {
+		// 不是本实例注册的，或者续约协程已经注销，只删除 key
+		return r.deleteService(ctx, svc, 0)
 	}
+	reg.cancel()
+	<-reg.done
+	return r.deleteService(ctx, reg.svc, reg.leaseID)
+}
 
-	// 释放租约
-	if svc.leaseID != 0 {
-		_, err = r.client.Revoke(ctx, svc.leaseID)
-		return err
+// UnregisterAll 停止续约并并发注销本实例注册的所有服务，注册中心仍可继续使用
+func (r *EtcdRegistry) UnregisterAll(ctx context.Context) error {
+	r.mutex.Lock()
+	registrations := r.registrations
+	r.registrations = make(map[string]*registration)
+	r.mutex.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		errs  []error
+	)
+	for _, reg := range registrations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reg.cancel()
+			<-reg.done
+			if err := r.deleteService(ctx, reg.svc, reg.leaseID); err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}()
 	}
-	return nil
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
-func (r *EtcdRegistry) Subscribe(serviceName string, callback func([]*Service)) error {
-	// 构造监听的前缀键
-	watchKey := r.prefix + "/" + serviceName
-	logger.Debugf("watch key: %s", watchKey)
-
-	// 初始获取当前服务列表
-	initialServices, err := r.discoverServices(watchKey)
+// deleteService 删除 key 并释放租约，leaseID 为 0 时只删除 key
+func (r *EtcdRegistry) deleteService(ctx context.Context, svc *Service, leaseID clientv3.LeaseID) error {
+	key := svc.buildServerKey(r.prefix)
+	_, err := r.client.Delete(ctx, key)
 	if err != nil {
 		return err
 	}
-	callback(initialServices)
-
-	// 启动监听goroutine
-	go r.watchServices(watchKey, callback)
 
+	// 释放租约
+	if leaseID != 0 {
+		if _, err = r.client.Revoke(ctx, leaseID); err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			return err
+		}
+	}
+	r.emit(svc, StateDeregistered, nil)
 	return nil
 }
 
-// watchServices 监听指定前缀的服务变化
-func (r *EtcdRegistry) watchServices(watchKey string, callback func([]*Service)) {
-	watcher := clientv3.NewWatcher(r.client)
-	defer watcher.Close()
-
-	watchChan := watcher.Watch(context.Background(), watchKey, clientv3.WithPrefix())
-	var mutex sync.Mutex
-	for range watchChan {
-		mutex.Lock()
-		services, err := r.discoverServices(watchKey)
+// MarkHealth 修改实例的健康状态
+// 写入时保留原有租约，并通过 ModRevision 比较避免覆盖并发的修改
+func (r *EtcdRegistry) MarkHealth(ctx context.Context, svc *Service, healthy bool) error {
+	key := svc.buildServerKey(r.prefix)
+	for {
+		resp, err := r.client.Get(ctx, key)
 		if err != nil {
-			log.Printf("watch services error: %v", err)
-			continue
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return ErrServiceNotFound
+		}
+		kv := resp.Kvs[0]
+		current, err := unmarshalService(kv.Value)
+		if err != nil {
+			return err
+		}
+		if !current.setHealth(healthy) {
+			return nil
+		}
+		value, err := current.marshal()
+		if err != nil {
+			return err
+		}
+		txn, err := r.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(key, value, clientv3.WithIgnoreLease())).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if txn.Succeeded {
+			return nil
 		}
-		callback(services)
-		mutex.Unlock()
 	}
 }
 
-func (r *EtcdRegistry) discoverServices(watchKey string) ([]*Service, error) {
+// Close 注销本实例注册的所有服务，停止所有续约和 watch 协程，并关闭 etcd 客户端
+// 重复调用直接返回 nil
+func (r *EtcdRegistry) Close() error {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mutex.Unlock()
 
-	resp, err := r.client.Get(context.Background(), watchKey, clientv3.WithPrefix())
-	if err != nil {
-		return nil, err
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	var errs []error
+	if err := r.UnregisterAll(ctx); err != nil {
+		errs = append(errs, err)
 	}
-	var services []*Service
-	for _, kv := range resp.Kvs {
-		var svc Service
-		if err := json.Unmarshal(kv.Value, &svc); err != nil {
-			continue // 跳过无效数据
-		}
-		services = append(services, &svc)
+
+	r.cancel()
+	r.wg.Wait()
+	if err := r.client.Close(); err != nil {
+		errs = append(errs, err)
 	}
-	return services, nil
+	return errors.Join(errs...)
 }
-
-func (r *EtcdRegistry) Close() error { return nil }
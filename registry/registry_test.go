@@ -1,79 +1,272 @@
-package registry
+package registry_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/lwm-galactic/logger"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/internal/etcdtest"
+	"github.com/lwm-galactic/tools/registry/registrytest"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func TestNewEtcdRegistry1(t *testing.T) {
-	etcdRegistry, err := NewEtcdRegistry(
-		WithUsername("root"),
-		WithPassword("root"),
-	)
+var _ registry.Registry = (*registry.EtcdRegistry)(nil)
+
+func newEtcdRegistry(t *testing.T, server *etcdtest.Server, opts ...registry.Option) registry.Registry {
+	t.Helper()
+	r, err := registry.NewEtcdRegistry(append([]registry.Option{registry.WithEndpoints(server.Endpoints)}, opts...)...)
 	if err != nil {
-		logger.Errorf("NewEtcdRegistry err: %v", err)
-		return
+		t.Fatalf("NewEtcdRegistry: %v", err)
 	}
-	svc := Service{
-		Name: "Test",
-		Addr: "127.0.0.2",
-		Port: 1239,
-		TTL:  5 * time.Second,
+	return r
+}
+
+func TestEtcdRegistry(t *testing.T) {
+	server := etcdtest.Start(t)
+	// 所有子测试共用一个 etcd，每个子测试使用独立的命名空间
+	var seq atomic.Int32
+	registrytest.Run(t, func(t *testing.T) registrytest.NewRegistry {
+		namespace := fmt.Sprintf("test-%d", seq.Add(1))
+		return func() registry.Registry {
+			return newEtcdRegistry(t, server, registry.WithNamespace(namespace))
+		}
+	})
+}
+
+func TestEtcdRegistryExpiry(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	consumer := newEtcdRegistry(t, server)
+	defer consumer.Close()
+
+	events := make(chan registry.ServiceEvent, 10)
+	cancel, err := consumer.SubscribeEvents("order", func(evs []registry.ServiceEvent) {
+		for _, e := range evs {
+			events <- e
+		}
+	})
+	if err != nil {
+		t.Fatalf("SubscribeEvents: %v", err)
 	}
-	err = etcdRegistry.Register(context.Background(), &svc)
+	defer cancel()
+
+	// 模拟进程崩溃后残留的实例：租约不再续约，到期后 key 被 etcd 删除
+	ctx := context.Background()
+	lease, err := client.Grant(ctx, 1)
 	if err != nil {
-		logger.Errorf("register err: %v", err)
-		return
+		t.Fatalf("Grant: %v", err)
+	}
+	svc := &registry.Service{ID: "order-1", Name: "order", Addr: "127.0.0.1", Port: 8001, TTL: time.Second}
+	value, _ := json.Marshal(svc)
+	if _, err := client.Put(ctx, "/services/order/order-1", string(value), clientv3.WithLease(lease.ID)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	for _, want := range []registry.EventType{registry.EventAdded, registry.EventRemoved} {
+		select {
+		case e := <-events:
+			if e.Type != want || e.Service.ID != "order-1" {
+				t.Fatalf("event = %v %s, want %v order-1", e.Type, e.Service.ID, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
 	}
-	time.Sleep(10 * time.Second)
-	etcdRegistry.Unregister(context.Background(), &svc)
 }
 
-func TestNewEtcdRegistry2(t *testing.T) {
-	etcdRegistry, err := NewEtcdRegistry(
-		WithUsername("root"),
-		WithPassword("root"),
-	)
-	if err != nil {
-		logger.Errorf("NewEtcdRegistry err: %v", err)
-		return
+func TestEtcdRegistryReregister(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	states := make(chan registry.RegistrationState, 10)
+	producer := newEtcdRegistry(t, server, registry.WithRegistrationHandler(func(e registry.RegistrationEvent) {
+		states <- e.State
+	}))
+	defer producer.Close()
+
+	ctx := context.Background()
+	svc := &registry.Service{ID: "order-1", Name: "order", Addr: "127.0.0.1", Port: 8001, TTL: 2 * time.Second}
+	if err := producer.Register(ctx, svc); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	registered := *svc
+	resp, err := client.Get(ctx, "/services/order/order-1")
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("Get = %v, %v", resp, err)
+	}
+	lease := clientv3.LeaseID(resp.Kvs[0].Lease)
+
+	// 租约被撤销后自动申请新租约并重新写入
+	if _, err := client.Revoke(ctx, lease); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	for _, want := range []registry.RegistrationState{registry.StateRegistered, registry.StateLeaseLost, registry.StateReregistered} {
+		select {
+		case got := <-states:
+			if got != want {
+				t.Fatalf("state = %v, want %v", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+	resp, err = client.Get(ctx, "/services/order/order-1")
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("instance should be written back, got %v, %v", resp, err)
+	}
+	newLease := clientv3.LeaseID(resp.Kvs[0].Lease)
+	if newLease == lease {
+		t.Fatalf("instance should be attached to a new lease")
+	}
+	// 续约协程使用注册时的副本，不会修改调用方的 svc
+	if !reflect.DeepEqual(*svc, registered) {
+		t.Fatalf("reregistration modified the caller's service:\n got %+v\nwant %+v", *svc, registered)
+	}
+
+	// Unregister 后不再续约，key 被删除
+	if err := producer.Unregister(ctx, svc); err != nil {
+		t.Fatalf("Unregister: %v", err)
+	}
+	if got := <-states; got != registry.StateDeregistered {
+		t.Fatalf("state = %v, want %v", got, registry.StateDeregistered)
 	}
-	svc := Service{
-		Name: "Test",
-		Addr: "127.0.0.1",
-		Port: 1239,
-		TTL:  5 * time.Second,
+	resp, err = client.Get(ctx, "/services/order/order-1")
+	if err != nil || len(resp.Kvs) != 0 {
+		t.Fatalf("instance should be deleted, got %v, %v", resp, err)
 	}
-	err = etcdRegistry.Register(context.Background(), &svc)
+	if ttl, err := client.TimeToLive(ctx, newLease); err != nil || ttl.TTL != -1 {
+		t.Fatalf("new lease should be revoked, got %v, %v", ttl, err)
+	}
+}
+
+func putService(t *testing.T, client *clientv3.Client, id, version string) {
+	t.Helper()
+	value, err := json.Marshal(&registry.Service{ID: id, Name: "order", Addr: "127.0.0.1", Port: 8001, Version: version})
 	if err != nil {
-		logger.Errorf("register err: %v", err)
-		return
+		t.Fatal(err)
+	}
+	if _, err := client.Put(context.Background(), "/services/order/"+id, string(value)); err != nil {
+		t.Fatalf("Put: %v", err)
 	}
 }
 
-func TestEtcd(t *testing.T) {
-	etcdRegistry, err := NewEtcdRegistry(
-		WithUsername("root"),
-		WithPassword("root"),
-	)
+// subscribeThroughProxy 通过代理订阅 order 服务，事件格式为 "<type> <id>"
+func subscribeThroughProxy(t *testing.T, server *etcdtest.Server, proxy *etcdtest.Proxy) <-chan string {
+	t.Helper()
+	consumer := newEtcdRegistry(t, server, registry.WithEndpoints(proxy.Endpoints))
+	t.Cleanup(func() {
+		_ = consumer.Close()
+	})
+	events := make(chan string, 100)
+	cancel, err := consumer.SubscribeEvents("order", func(evs []registry.ServiceEvent) {
+		for _, e := range evs {
+			events <- e.Type.String() + " " + e.Service.ID
+		}
+	})
 	if err != nil {
-		logger.Errorf("NewEtcdRegistry err: %v", err)
-		return
+		t.Fatalf("SubscribeEvents: %v", err)
+	}
+	t.Cleanup(cancel)
+	return events
+}
+
+func expectEvents(t *testing.T, events <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Fatalf("event = %q, want %q", got, w)
+			}
+		case <-time.After(15 * time.Second):
+			t.Fatalf("timed out waiting for event %q", w)
+		}
+	}
+}
+
+func TestEtcdRegistryWatchResume(t *testing.T) {
+	server := etcdtest.Start(t)
+	proxy := server.Proxy(t)
+	client := server.Client(t)
+	events := subscribeThroughProxy(t, server, proxy)
+	putService(t, client, "a", "v1")
+	expectEvents(t, events, "added a")
+
+	// 连接中断期间的变化在恢复后按顺序补发，不丢失也不重复
+	proxy.Pause()
+	putService(t, client, "b", "v1")
+	putService(t, client, "a", "v2")
+	putService(t, client, "c", "v1")
+	if _, err := client.Delete(context.Background(), "/services/order/c"); err != nil {
+		t.Fatalf("Delete: %v", err)
 	}
-	err = etcdRegistry.Subscribe("Test", callback)
+	time.Sleep(300 * time.Millisecond)
+	proxy.Resume()
+	expectEvents(t, events, "added b", "updated a", "added c", "removed c")
+
+	putService(t, client, "d", "v1")
+	expectEvents(t, events, "added d")
+}
+
+func TestEtcdRegistryWatchCompaction(t *testing.T) {
+	server := etcdtest.Start(t)
+	proxy := server.Proxy(t)
+	client := server.Client(t)
+	events := subscribeThroughProxy(t, server, proxy)
+	putService(t, client, "a", "v1")
+	putService(t, client, "c", "v1")
+	expectEvents(t, events, "added a", "added c")
+
+	// 中断期间的历史被压缩，恢复后重新拉取全量列表并补发差异
+	proxy.Pause()
+	putService(t, client, "a", "v2")
+	putService(t, client, "b", "v1")
+	resp, err := client.Delete(context.Background(), "/services/order/c")
 	if err != nil {
-		logger.Errorf("subscribe err: %v", err)
-		return
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := client.Compact(context.Background(), resp.Header.Revision); err != nil {
+		t.Fatalf("Compact: %v", err)
 	}
-	select {}
+	time.Sleep(300 * time.Millisecond)
+	proxy.Resume()
+	expectEvents(t, events, "updated a", "added b", "removed c")
 
+	putService(t, client, "d", "v1")
+	expectEvents(t, events, "added d")
 }
 
-func callback(svc []*Service) {
-	for _, s := range svc {
-		fmt.Println(*s)
+func TestEtcdRegistryMarkHealthKeepsLease(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	producer, checker := newEtcdRegistry(t, server), newEtcdRegistry(t, server)
+	defer producer.Close()
+	defer checker.Close()
+
+	ctx := context.Background()
+	svc := &registry.Service{ID: "order-1", Name: "order", Addr: "127.0.0.1", Port: 8001, TTL: 2 * time.Second}
+	if err := producer.Register(ctx, svc); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	before, err := client.Get(ctx, "/services/order/order-1")
+	if err != nil || len(before.Kvs) != 1 {
+		t.Fatalf("Get = %v, %v", before, err)
+	}
+	if err := checker.MarkHealth(ctx, svc, false); err != nil {
+		t.Fatalf("MarkHealth: %v", err)
+	}
+	after, err := client.Get(ctx, "/services/order/order-1")
+	if err != nil || len(after.Kvs) != 1 {
+		t.Fatalf("Get = %v, %v", after, err)
+	}
+	if after.Kvs[0].Lease != before.Kvs[0].Lease {
+		t.Fatalf("MarkHealth should keep the lease, %d != %d", after.Kvs[0].Lease, before.Kvs[0].Lease)
+	}
+	var got registry.Service
+	if err := json.Unmarshal(after.Kvs[0].Value, &got); err != nil || got.IsHealthy() {
+		t.Fatalf("instance should be marked unhealthy: %+v, %v", got, err)
 	}
 }
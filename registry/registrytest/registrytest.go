@@ -0,0 +1,342 @@
+// Package registrytest 提供 registry.Registry 实现共用的行为测试。
+//
+// 在实现所在包的测试文件中调用即可：
+//
+//	func TestRegistry(t *testing.T) {
+//		registrytest.Run(t, func(t *testing.T) registrytest.NewRegistry {
+//			backend := startBackend(t)
+//			return func() registry.Registry { return NewMyRegistry(backend) }
+//		})
+//	}
+package registrytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+)
+
+// NewRegistry 创建一个注册中心实例，同一个 Factory 返回的 NewRegistry 创建的实例共享同一份数据
+type NewRegistry func() registry.Registry
+
+// Factory 为每个子测试准备一份独立的数据，返回在其上创建注册中心的函数
+type Factory func(t *testing.T) NewRegistry
+
+// Timeout 等待异步通知的最长时间
+var Timeout = 5 * time.Second
+
+// Run 运行行为测试
+func Run(t *testing.T, factory Factory) {
+	t.Run("EmptySubscribe", func(t *testing.T) {
+		r := open(t, factory(t))
+		var (
+			called bool
+			got    []*registry.Service
+		)
+		cancel, err := r.Subscribe("empty", func(services []*registry.Service) {
+			called = true
+			got = services
+		})
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		defer cancel()
+		if !called || len(got) != 0 {
+			t.Fatalf("Subscribe should call back synchronously with an empty list, called=%v got=%v", called, got)
+		}
+	})
+
+	t.Run("RegisterSubscribe", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, consumer := open(t, newRegistry), open(t, newRegistry)
+		svc := newService("order", 1)
+		svc.Version = "v1.2.0"
+		svc.Zone = "zone-a"
+		svc.Tags = []string{"canary"}
+		svc.Metadata = map[string]string{"env": "test"}
+		if err := producer.Register(context.Background(), svc); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+
+		var got []*registry.Service
+		cancel, err := consumer.Subscribe("order", func(services []*registry.Service) {
+			got = services
+		})
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		defer cancel()
+		if len(got) != 1 {
+			t.Fatalf("got %d instances, want 1", len(got))
+		}
+		g := got[0]
+		if g.ID != svc.ID || g.Endpoint() != svc.Endpoint() || g.Version != "v1.2.0" || g.Zone != "zone-a" ||
+			!g.HasTag("canary") || g.Metadata["env"] != "test" || g.TTL != svc.TTL || g.RegisteredAt.IsZero() {
+			t.Fatalf("metadata not preserved: %+v", g)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, consumer := open(t, newRegistry), open(t, newRegistry)
+		events := subscribeEvents(t, consumer, "order")
+		events.expect(t)
+
+		svc := newService("order", 1)
+		if err := producer.Register(context.Background(), svc); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		events.expect(t, registry.EventAdded)
+
+		svc.Version = "v2"
+		if err := producer.Register(context.Background(), svc); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		if e := events.expect(t, registry.EventUpdated); e[0].Service.Version != "v2" {
+			t.Fatalf("updated version = %s, want v2", e[0].Service.Version)
+		}
+
+		if err := producer.Unregister(context.Background(), svc); err != nil {
+			t.Fatalf("Unregister: %v", err)
+		}
+		if e := events.expect(t, registry.EventRemoved); e[0].Service.ID != svc.ID {
+			t.Fatalf("removed %s, want %s", e[0].Service.ID, svc.ID)
+		}
+	})
+
+	t.Run("NameIsolation", func(t *testing.T) {
+		r := open(t, factory(t))
+		if err := r.Register(context.Background(), newService("orders", 1)); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		if err := r.Register(context.Background(), newService("order", 2)); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		var got []*registry.Service
+		cancel, err := r.Subscribe("order", func(services []*registry.Service) {
+			got = services
+		})
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		defer cancel()
+		if len(got) != 1 || got[0].Name != "order" {
+			t.Fatalf("subscribe order got %v", got)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, consumer := open(t, newRegistry), open(t, newRegistry)
+		events := subscribeEvents(t, consumer, "order")
+		events.expect(t)
+		events.cancel()
+
+		if err := producer.Register(context.Background(), newService("order", 1)); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		events.expectNone(t)
+	})
+
+	t.Run("ContextCancel", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, consumer := open(t, newRegistry), open(t, newRegistry)
+		events := subscribeEvents(t, consumer, "order")
+		events.expect(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := producer.Register(ctx, newService("order", 1)); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		events.expect(t, registry.EventAdded)
+		cancel()
+		events.expect(t, registry.EventRemoved)
+	})
+
+	t.Run("MarkHealth", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, checker := open(t, newRegistry), open(t, newRegistry)
+		events := subscribeEvents(t, checker, "order")
+		events.expect(t)
+
+		svc := newService("order", 1)
+		svc.Metadata = map[string]string{"env": "test"}
+		if err := producer.Register(context.Background(), svc); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		e := events.expect(t, registry.EventAdded)
+		if !e[0].Service.IsHealthy() {
+			t.Fatalf("new instance should be healthy")
+		}
+
+		// 由其他注册中心实例修改健康状态
+		if err := checker.MarkHealth(context.Background(), e[0].Service, false); err != nil {
+			t.Fatalf("MarkHealth: %v", err)
+		}
+		e = events.expect(t, registry.EventUpdated)
+		if e[0].Service.IsHealthy() || e[0].Service.Metadata["env"] != "test" {
+			t.Fatalf("instance should be unhealthy with metadata preserved: %+v", e[0].Service)
+		}
+		// 状态没有变化时不写入
+		if err := checker.MarkHealth(context.Background(), e[0].Service, false); err != nil {
+			t.Fatalf("MarkHealth: %v", err)
+		}
+		events.expectNone(t)
+
+		if err := checker.MarkHealth(context.Background(), e[0].Service, true); err != nil {
+			t.Fatalf("MarkHealth: %v", err)
+		}
+		if e = events.expect(t, registry.EventUpdated); !e[0].Service.IsHealthy() {
+			t.Fatalf("instance should be healthy again")
+		}
+
+		if err := checker.MarkHealth(context.Background(), newService("order", 2), false); !errors.Is(err, registry.ErrServiceNotFound) {
+			t.Fatalf("MarkHealth of missing instance = %v, want ErrServiceNotFound", err)
+		}
+	})
+
+	t.Run("CloseDeregisters", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, consumer := newRegistry(), open(t, newRegistry)
+		events := subscribeEvents(t, consumer, "order")
+		events.expect(t)
+
+		for i := 1; i <= 2; i++ {
+			if err := producer.Register(context.Background(), newService("order", i)); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			events.expect(t, registry.EventAdded)
+		}
+		if err := producer.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		events.expect(t, registry.EventRemoved, registry.EventRemoved)
+
+		if err := producer.Register(context.Background(), newService("order", 3)); !errors.Is(err, registry.ErrRegistryClosed) {
+			t.Fatalf("Register after Close = %v, want ErrRegistryClosed", err)
+		}
+		if err := producer.Close(); err != nil {
+			t.Fatalf("second Close: %v", err)
+		}
+	})
+
+	t.Run("UnregisterAll", func(t *testing.T) {
+		newRegistry := factory(t)
+		producer, consumer := open(t, newRegistry), open(t, newRegistry)
+		unregisterer, ok := producer.(registry.Unregisterer)
+		if !ok {
+			t.Skip("registry does not implement Unregisterer")
+		}
+		events := subscribeEvents(t, consumer, "order")
+		events.expect(t)
+
+		for i := 1; i <= 2; i++ {
+			if err := producer.Register(context.Background(), newService("order", i)); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			events.expect(t, registry.EventAdded)
+		}
+		if err := unregisterer.UnregisterAll(context.Background()); err != nil {
+			t.Fatalf("UnregisterAll: %v", err)
+		}
+		events.expect(t, registry.EventRemoved, registry.EventRemoved)
+
+		// 注销后注册中心仍可继续使用
+		if err := producer.Register(context.Background(), newService("order", 3)); err != nil {
+			t.Fatalf("Register after UnregisterAll: %v", err)
+		}
+		events.expect(t, registry.EventAdded)
+	})
+}
+
+// open 创建注册中心，测试结束时关闭
+func open(t *testing.T, newRegistry NewRegistry) registry.Registry {
+	t.Helper()
+	r := newRegistry()
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+	return r
+}
+
+func newService(name string, i int) *registry.Service {
+	return &registry.Service{
+		ID:   fmt.Sprintf("%s-%d", name, i),
+		Name: name,
+		Addr: "127.0.0.1",
+		Port: 8000 + i,
+		TTL:  5 * time.Second,
+	}
+}
+
+// eventRecorder 收集订阅到的事件，逐个取出比较
+type eventRecorder struct {
+	mutex  sync.Mutex
+	events []registry.ServiceEvent
+	first  bool // 是否收到了首次同步回调
+	notify chan struct{}
+	cancel registry.CancelFunc
+}
+
+func subscribeEvents(t *testing.T, r registry.Registry, name string) *eventRecorder {
+	t.Helper()
+	rec := &eventRecorder{notify: make(chan struct{}, 1)}
+	cancel, err := r.SubscribeEvents(name, func(events []registry.ServiceEvent) {
+		rec.mutex.Lock()
+		rec.first = true
+		rec.events = append(rec.events, events...)
+		rec.mutex.Unlock()
+		select {
+		case rec.notify <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("SubscribeEvents: %v", err)
+	}
+	rec.cancel = cancel
+	t.Cleanup(cancel)
+	return rec
+}
+
+// expect 等待并取出指定类型的事件；不传类型时检查首次同步已完成且没有事件
+func (rec *eventRecorder) expect(t *testing.T, types ...registry.EventType) []registry.ServiceEvent {
+	t.Helper()
+	deadline := time.After(Timeout)
+	for {
+		rec.mutex.Lock()
+		if rec.first && len(rec.events) >= len(types) {
+			got := rec.events[:len(types)]
+			rec.events = rec.events[len(types):]
+			rec.mutex.Unlock()
+			for i, e := range got {
+				if e.Type != types[i] {
+					t.Fatalf("event %d = %v, want %v", i, e.Type, types[i])
+				}
+			}
+			return got
+		}
+		rec.mutex.Unlock()
+		select {
+		case <-rec.notify:
+		case <-deadline:
+			t.Fatalf("timed out waiting for %v", types)
+		}
+	}
+}
+
+// expectNone 等待一小段时间，确认没有收到事件
+func (rec *eventRecorder) expectNone(t *testing.T) {
+	t.Helper()
+	time.Sleep(200 * time.Millisecond)
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if len(rec.events) > 0 {
+		t.Fatalf("unexpected events: %v", rec.events)
+	}
+}
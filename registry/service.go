@@ -1,24 +1,156 @@
 package registry
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"maps"
+	"slices"
+	"strconv"
 	"time"
 )
 
+// Service 服务实例信息，以 JSON 形式保存在 etcd 中
 type Service struct {
-	Name          string
-	Addr          string
-	Port          int
-	TTL           time.Duration
-	leaseID       clientv3.LeaseID
-	LastHeartbeat time.Time
+	ID       string            `json:"id"`                 // 实例 ID，为空时注册时使用 addr:port
+	Name     string            `json:"name"`               // 服务名
+	Version  string            `json:"version,omitempty"`  // 服务版本，用于按版本路由
+	Addr     string            `json:"addr"`               // 地址
+	Port     int               `json:"port"`               // 端口
+	Protocol string            `json:"protocol,omitempty"` // 协议，如 grpc、http
+	Zone     string            `json:"zone,omitempty"`     // 可用区，用于就近路由
+	Weight   int               `json:"weight,omitempty"`   // 权重，<= 0 时按 1 处理
+	Tags     []string          `json:"tags,omitempty"`     // 标签
+	Metadata map[string]string `json:"metadata,omitempty"` // 任意键值元数据
+	Check    *HealthCheck      `json:"check,omitempty"`    // 健康检查声明，由 HealthChecker 执行
+
+	TTL           time.Duration `json:"ttl"`            // 租约时长
+	RegisteredAt  time.Time     `json:"registered_at"`  // 注册时间
+	LastHeartbeat time.Time     `json:"last_heartbeat"` // 最近一次确认存活的时间
+}
+
+// 健康检查结果保存在实例元数据中
+const (
+	MetadataHealth  = "health"    // 健康状态的元数据 key
+	HealthUnhealthy = "unhealthy" // 实例被健康检查判定为不健康
+)
+
+// IsHealthy 判断实例是否健康
+// 存活由租约保证，租约过期的实例会从注册中心删除；这里只看健康检查写入的元数据
+func (s *Service) IsHealthy() bool {
+	return s.Metadata[MetadataHealth] != HealthUnhealthy
+}
+
+// setHealth 修改健康状态，返回是否发生变化
+func (s *Service) setHealth(healthy bool) bool {
+	if s.IsHealthy() == healthy {
+		return false
+	}
+	if healthy {
+		delete(s.Metadata, MetadataHealth)
+		return true
+	}
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]string)
+	}
+	s.Metadata[MetadataHealth] = HealthUnhealthy
+	return true
+}
+
+// Endpoint 返回 addr:port 形式的地址
+func (s *Service) Endpoint() string {
+	return s.Addr + ":" + strconv.Itoa(s.Port)
+}
+
+// HasTag 判断实例是否带有指定标签
+func (s *Service) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveWeight 返回用于负载均衡的权重，未设置时为 1
+func (s *Service) EffectiveWeight() int {
+	if s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
 }
 
-func (s *Service) IsHealthy(now time.Time) bool {
-	return now.Sub(s.LastHeartbeat) < s.TTL
+// instanceID 返回实例的唯一标识，未设置 ID 时使用 addr:port
+func (s *Service) instanceID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.Endpoint()
+}
+
+func (s *Service) validate() error {
+	if s.Name == "" {
+		return errors.New("service name is required")
+	}
+	if s.Addr == "" {
+		return errors.New("service addr is required")
+	}
+	if s.TTL < time.Second {
+		return fmt.Errorf("service ttl %v must >= 1s", s.TTL)
+	}
+	return nil
+}
+
+// prepare 注册前校验并补全默认字段
+func (s *Service) prepare(now time.Time) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if s.ID == "" {
+		s.ID = s.Endpoint()
+	}
+	if s.RegisteredAt.IsZero() {
+		s.RegisteredAt = now
+	}
+	s.LastHeartbeat = now
+	return nil
+}
+
+// leaseTTL 返回租约的秒数，不足一秒的部分向上取整，租约不会比 TTL 更早过期
+func (s *Service) leaseTTL() int64 {
+	return int64((s.TTL + time.Second - 1) / time.Second)
+}
+
+// clone 深拷贝，避免调用方修改已注册的实例
+func (s *Service) clone() *Service {
+	c := *s
+	c.Tags = slices.Clone(s.Tags)
+	c.Metadata = maps.Clone(s.Metadata)
+	if s.Check != nil {
+		check := *s.Check
+		c.Check = &check
+	}
+	return &c
 }
 
 func (s *Service) buildServerKey(prefix string) string {
-	return fmt.Sprintf("%s/%s/%s:%d", prefix, s.Name, s.Addr, s.Port)
+	return fmt.Sprintf("%s/%s/%s", prefix, s.Name, s.instanceID())
+}
+
+// marshal 序列化为写入存储的值
+func (s *Service) marshal() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// unmarshalService 解析存储中的值
+func unmarshalService(data []byte) (*Service, error) {
+	var svc Service
+	if err := json.Unmarshal(data, &svc); err != nil {
+		return nil, err
+	}
+	return &svc, nil
 }
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceRoundTrip(t *testing.T) {
+	svc := &Service{
+		ID:           "node-1",
+		Name:         "order",
+		Version:      "v1.2.0",
+		Addr:         `10.0.0.1"`, // 需要转义的字符
+		Port:         8080,
+		Protocol:     "grpc",
+		Zone:         "cn-east-1a",
+		Weight:       10,
+		Tags:         []string{"canary"},
+		Metadata:     map[string]string{"env": "prod", "quote": `a"b`},
+		TTL:          5 * time.Second,
+		RegisteredAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	value, err := svc.marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	got, err := unmarshalService([]byte(value))
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, svc) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", got, svc)
+	}
+	if !got.HasTag("canary") || got.HasTag("stable") {
+		t.Fatalf("HasTag mismatch")
+	}
+}
+
+func TestServiceKey(t *testing.T) {
+	svc := &Service{Name: "order", Addr: "10.0.0.1", Port: 8080}
+	if got := svc.buildServerKey("/services"); got != "/services/order/10.0.0.1:8080" {
+		t.Fatalf("key without id = %s", got)
+	}
+	svc.ID = "node-1"
+	if got := svc.buildServerKey("/services"); got != "/services/order/node-1" {
+		t.Fatalf("key with id = %s", got)
+	}
+	if (&Service{}).EffectiveWeight() != 1 {
+		t.Fatalf("default weight should be 1")
+	}
+	if err := (&Service{Name: "order", Addr: "x", TTL: 0}).validate(); err == nil {
+		t.Fatalf("zero ttl should be rejected")
+	}
+	for ttl, want := range map[time.Duration]int64{time.Second: 1, 1500 * time.Millisecond: 2, 10 * time.Second: 10} {
+		if got := (&Service{TTL: ttl}).leaseTTL(); got != want {
+			t.Fatalf("leaseTTL(%v) = %d, want %d", ttl, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lwm-galactic/logger"
+	"github.com/lwm-galactic/tools/shutdown"
+)
+
+var (
+	_ shutdown.ShutdownCallback = (*ShutdownCallback)(nil)
+
+	_ Unregisterer = (*EtcdRegistry)(nil)
+	_ Unregisterer = (*RedisRegistry)(nil)
+	_ Unregisterer = (*MemoryRegistry)(nil)
+)
+
+// Unregisterer 可以一次注销本实例注册的所有服务，注销后仍可继续注册
+type Unregisterer interface {
+	UnregisterAll(ctx context.Context) error
+}
+
+// ShutdownOptions 优雅退出回调的配置
+type ShutdownOptions struct {
+	// 注销后等待的时长，让订阅者收到删除事件并停止把请求路由到本实例
+	PropagationDelay time.Duration
+	// 注销所有服务的超时时间
+	Timeout time.Duration
+	// 等待结束后依次执行的回调，例如关闭 HTTP/gRPC 服务
+	Drain []shutdown.ShutdownCallback
+}
+
+// ShutdownOption 优雅退出回调的配置函数
+type ShutdownOption func(*ShutdownOptions)
+
+// WithPropagationDelay 设置注销后等待的时长
+func WithPropagationDelay(delay time.Duration) ShutdownOption {
+	return func(o *ShutdownOptions) {
+		o.PropagationDelay = delay
+	}
+}
+
+// WithShutdownTimeout 设置注销所有服务的超时时间
+func WithShutdownTimeout(timeout time.Duration) ShutdownOption {
+	return func(o *ShutdownOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// WithDrain 添加等待结束后执行的回调
+// GracefulShutdown 会并发执行所有回调，需要在注销之后才关闭的服务应该通过这里添加，而不是直接添加到 GracefulShutdown
+func WithDrain(callbacks ...shutdown.ShutdownCallback) ShutdownOption {
+	return func(o *ShutdownOptions) {
+		o.Drain = append(o.Drain, callbacks...)
+	}
+}
+
+// NewShutdownOptions 创建优雅退出回调的配置，默认等待 5s，注销超时 5s
+func NewShutdownOptions(opts ...ShutdownOption) *ShutdownOptions {
+	options := &ShutdownOptions{
+		PropagationDelay: 5 * time.Second,
+		Timeout:          unregisterTimeout,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// ShutdownCallback 把注册中心接入 shutdown.GracefulShutdown
+// 收到退出信号时先注销所有服务，等待 PropagationDelay 让客户端停止路由，再执行 Drain 回调。
+// 不会关闭注册中心，需要时可以把注册中心的 Close 放在 Drain 的最后。
+type ShutdownCallback struct {
+	registry Unregisterer
+	options  *ShutdownOptions
+}
+
+// NewShutdownCallback 创建注册中心的优雅退出回调，EtcdRegistry、RedisRegistry 和 MemoryRegistry 都可以使用
+func NewShutdownCallback(registry Unregisterer, opts ...ShutdownOption) *ShutdownCallback {
+	return &ShutdownCallback{
+		registry: registry,
+		options:  NewShutdownOptions(opts...),
+	}
+}
+
+// OnShutdown 注销失败时仍然等待并执行 Drain 回调，返回所有错误
+func (c *ShutdownCallback) OnShutdown(managerName string) error {
+	var errs []error
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	if err := c.registry.UnregisterAll(ctx); err != nil {
+		logger.Errorf("unregister services on shutdown by %s err: %v", managerName, err)
+		errs = append(errs, err)
+	}
+	cancel()
+
+	logger.Infof("services unregistered on shutdown by %s, wait %s before draining", managerName, c.options.PropagationDelay)
+	time.Sleep(c.options.PropagationDelay)
+
+	for _, cb := range c.options.Drain {
+		if err := cb.OnShutdown(managerName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
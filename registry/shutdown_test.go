@@ -0,0 +1,71 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lwm-galactic/tools/registry"
+	"github.com/lwm-galactic/tools/registry/internal/etcdtest"
+	"github.com/lwm-galactic/tools/shutdown"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestShutdownCallback(t *testing.T) {
+	server := etcdtest.Start(t)
+	client := server.Client(t)
+	r := newEtcdRegistry(t, server)
+	defer r.Close()
+
+	ctx := context.Background()
+	for _, svc := range []*registry.Service{
+		{ID: "order-1", Name: "order", Addr: "127.0.0.1", Port: 8001, TTL: 5 * time.Second},
+		{ID: "user-1", Name: "user", Addr: "127.0.0.1", Port: 8002, TTL: 5 * time.Second},
+	} {
+		if err := r.Register(ctx, svc); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+
+	// Drain 回调在注销并等待之后执行
+	const delay = 200 * time.Millisecond
+	var (
+		start   time.Time
+		drained time.Duration
+		remain  = -1
+	)
+	drainErr := errors.New("drain failed")
+	cb := registry.NewShutdownCallback(r.(registry.Unregisterer), registry.WithPropagationDelay(delay),
+		registry.WithDrain(
+			shutdown.ShutdownFunc(func(managerName string) error {
+				drained = time.Since(start)
+				resp, err := client.Get(ctx, "/services/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+				if err != nil {
+					return err
+				}
+				remain = int(resp.Count)
+				return nil
+			}),
+			shutdown.ShutdownFunc(func(managerName string) error {
+				return drainErr
+			}),
+		))
+
+	start = time.Now()
+	if err := cb.OnShutdown("test"); !errors.Is(err, drainErr) {
+		t.Fatalf("OnShutdown = %v, want drain error", err)
+	}
+	if remain != 0 {
+		t.Fatalf("services should be unregistered before draining, %d left", remain)
+	}
+	if drained < delay {
+		t.Fatalf("drain ran after %s, want at least %s", drained, delay)
+	}
+
+	// 注册中心仍可继续使用
+	svc := &registry.Service{ID: "order-2", Name: "order", Addr: "127.0.0.1", Port: 8003, TTL: 5 * time.Second}
+	if err := r.Register(ctx, svc); err != nil {
+		t.Fatalf("Register after shutdown callback: %v", err)
+	}
+}
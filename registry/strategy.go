@@ -1,17 +1,273 @@
 package registry
 
+import (
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lwm-galactic/tools/murmur3"
+)
+
 // Strategy 负载均衡策略
+// 所有内置策略都可以被多个协程并发调用
 type Strategy func([]*Service) *Service
 
 // RoundRobinStrategy 轮询
 func RoundRobinStrategy() Strategy {
-	var index int
+	var index atomic.Uint64
+	return func(instances []*Service) *Service {
+		if len(instances) == 0 {
+			return nil
+		}
+		i := index.Add(1) - 1
+		return instances[i%uint64(len(instances))]
+	}
+}
+
+// RandomStrategy 随机选择
+func RandomStrategy() Strategy {
+	return func(instances []*Service) *Service {
+		if len(instances) == 0 {
+			return nil
+		}
+		return instances[rand.IntN(len(instances))]
+	}
+}
+
+// WeightedRoundRobinStrategy 平滑加权轮询（与 nginx 的算法相同），按 Service.Weight 分配请求
+// 权重为 5、1、1 的三个实例会得到 a a b a c a a 这样的序列，而不是连续的 a a a a a b c
+func WeightedRoundRobinStrategy() Strategy {
+	var (
+		mutex   sync.Mutex
+		current = make(map[string]int)
+	)
+	return func(instances []*Service) *Service {
+		if len(instances) == 0 {
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		var (
+			best  *Service
+			total int
+			seen  = make(map[string]int, len(instances))
+		)
+		for _, svc := range instances {
+			id := svc.instanceID()
+			weight := svc.EffectiveWeight()
+			seen[id] = current[id] + weight
+			total += weight
+			if best == nil || seen[id] > seen[best.instanceID()] {
+				best = svc
+			}
+		}
+		seen[best.instanceID()] -= total
+		// 只保留当前实例的状态，下线的实例随之清理
+		current = seen
+		return best
+	}
+}
+
+// Outstanding 记录每个实例上尚未完成的请求数
+// 配合 LeastOutstandingStrategy 和 PowerOfTwoChoicesStrategy 使用，
+// 策略选中实例时计数加一，请求结束后必须调用 Done 减一
+type Outstanding struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// NewOutstanding 创建请求计数器
+func NewOutstanding() *Outstanding {
+	return &Outstanding{counts: make(map[string]int64)}
+}
+
+// Done 标记发往 svc 的一个请求已结束
+func (o *Outstanding) Done(svc *Service) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	id := svc.instanceID()
+	if o.counts[id] <= 1 {
+		delete(o.counts, id)
+		return
+	}
+	o.counts[id]--
+}
+
+// Count 返回 svc 上尚未完成的请求数
+func (o *Outstanding) Count(svc *Service) int64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.counts[svc.instanceID()]
+}
+
+// LeastOutstandingStrategy 选择未完成请求最少的实例，数量相同时选择靠前的实例
+func LeastOutstandingStrategy(o *Outstanding) Strategy {
 	return func(instances []*Service) *Service {
 		if len(instances) == 0 {
 			return nil
 		}
-		instance := instances[index%len(instances)]
-		index++
-		return instance
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		best := instances[0]
+		for _, svc := range instances[1:] {
+			if o.counts[svc.instanceID()] < o.counts[best.instanceID()] {
+				best = svc
+			}
+		}
+		o.counts[best.instanceID()]++
+		return best
+	}
+}
+
+// PowerOfTwoChoicesStrategy 随机选择两个实例，取未完成请求较少的一个
+// 效果接近 LeastOutstandingStrategy，但不需要遍历所有实例，也不会让所有客户端同时涌向同一个实例
+func PowerOfTwoChoicesStrategy(o *Outstanding) Strategy {
+	return func(instances []*Service) *Service {
+		switch len(instances) {
+		case 0:
+			return nil
+		case 1:
+			o.mutex.Lock()
+			o.counts[instances[0].instanceID()]++
+			o.mutex.Unlock()
+			return instances[0]
+		}
+		i := rand.IntN(len(instances))
+		j := rand.IntN(len(instances) - 1)
+		if j >= i {
+			j++
+		}
+		a, b := instances[i], instances[j]
+
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		if o.counts[b.instanceID()] < o.counts[a.instanceID()] {
+			a = b
+		}
+		o.counts[a.instanceID()]++
+		return a
+	}
+}
+
+// ConsistentHashStrategy 基于 murmur3 的一致性哈希，相同的请求 key 总是落到同一个实例上
+// replicas 为每个实例在哈希环上的虚拟节点数，<= 0 时使用 160
+// 返回的函数根据请求 key 生成 Strategy，实例列表不变时哈希环会被复用：
+//
+//	hash := ConsistentHashStrategy(0)
+//	svc := hash(userID)(instances)
+func ConsistentHashStrategy(replicas int) func(key string) Strategy {
+	if replicas <= 0 {
+		replicas = 160
+	}
+	var (
+		mutex sync.Mutex
+		ring  *hashRing
+	)
+	return func(key string) Strategy {
+		return func(instances []*Service) *Service {
+			if len(instances) == 0 {
+				return nil
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if ring == nil || !ring.bind(instances) {
+				ring = newHashRing(instances, replicas)
+			}
+			// 环上只保存实例 ID，返回当前列表中的实例以获得最新的元数据
+			svc, ok := ring.pick(instances, key)
+			if !ok {
+				// 列表在原地被修改过，下标映射已经失效
+				ring = newHashRing(instances, replicas)
+				svc, _ = ring.pick(instances, key)
+			}
+			return svc
+		}
+	}
+}
+
+// hashRing 一致性哈希环
+// 同一个实例列表（相同的底层数组和长度）直接复用；列表重新生成但实例 ID 不变时，
+// 通过 ID 的指纹判断，只重建 ID 到下标的映射而不重建环
+type hashRing struct {
+	fingerprint uint64         // 实例 ID 的指纹，与顺序无关
+	list        **Service      // 最近一次使用的实例列表的底层数组，用于判断是否为同一个列表
+	size        int            // 最近一次使用的实例列表的长度
+	index       map[string]int // 实例 ID 在最近一次使用的列表中的下标
+	hashes      []uint64
+	nodes       map[uint64]string
+}
+
+func newHashRing(instances []*Service, replicas int) *hashRing {
+	r := &hashRing{
+		fingerprint: fingerprint(instances),
+		nodes:       make(map[uint64]string, len(instances)*replicas),
+	}
+	for _, svc := range instances {
+		id := svc.instanceID()
+		for i := 0; i < replicas; i++ {
+			h := murmur3.Sum64([]byte(id + "#" + strconv.Itoa(i)))
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = id
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	slices.Sort(r.hashes)
+	r.reindex(instances)
+	return r
+}
+
+// bind 判断环是否仍对应 instances，对应时更新 ID 到下标的映射
+func (r *hashRing) bind(instances []*Service) bool {
+	if &instances[0] == r.list && len(instances) == r.size {
+		return true
+	}
+	if fingerprint(instances) != r.fingerprint {
+		return false
+	}
+	r.reindex(instances)
+	return true
+}
+
+func (r *hashRing) reindex(instances []*Service) {
+	r.list, r.size = &instances[0], len(instances)
+	r.index = make(map[string]int, len(instances))
+	for i, svc := range instances {
+		r.index[svc.instanceID()] = i
+	}
+}
+
+// pick 返回 key 在环上对应的实例，下标映射与 instances 不一致时 ok 为 false
+func (r *hashRing) pick(instances []*Service, key string) (*Service, bool) {
+	id := r.get(key)
+	i, ok := r.index[id]
+	if !ok || i >= len(instances) || instances[i].instanceID() != id {
+		return nil, false
+	}
+	return instances[i], true
+}
+
+func (r *hashRing) get(key string) string {
+	h := murmur3.Sum64([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// fingerprint 实例数量与各实例 ID 哈希值之和，与实例的顺序无关
+func fingerprint(instances []*Service) uint64 {
+	sum := uint64(len(instances))
+	for _, svc := range instances {
+		sum += murmur3.Sum64([]byte(svc.instanceID()))
 	}
+	return sum
 }
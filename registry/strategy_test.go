@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func newInstances(n int) []*Service {
+	instances := make([]*Service, n)
+	for i := range instances {
+		instances[i] = &Service{Name: "svc", Addr: "10.0.0." + strconv.Itoa(i), Port: 80}
+	}
+	return instances
+}
+
+func TestRoundRobinConcurrent(t *testing.T) {
+	instances := newInstances(4)
+	pick := RoundRobinStrategy()
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		counts = make(map[*Service]int)
+	)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				svc := pick(instances)
+				mutex.Lock()
+				counts[svc]++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, svc := range instances {
+		if counts[svc] != 2000 {
+			t.Fatalf("%s picked %d times, want 2000", svc.Addr, counts[svc])
+		}
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	instances := newInstances(3)
+	instances[0].Weight = 5
+	pick := WeightedRoundRobinStrategy()
+
+	var seq []int
+	for i := 0; i < 7; i++ {
+		svc := pick(instances)
+		for j, s := range instances {
+			if s == svc {
+				seq = append(seq, j)
+			}
+		}
+	}
+	want := []int{0, 0, 1, 0, 2, 0, 0}
+	for i := range want {
+		if seq[i] != want[i] {
+			t.Fatalf("sequence = %v, want %v", seq, want)
+		}
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	instances := newInstances(3)
+	o := NewOutstanding()
+	pick := LeastOutstandingStrategy(o)
+
+	a, b, c := pick(instances), pick(instances), pick(instances)
+	if a == b || b == c || a == c {
+		t.Fatalf("least outstanding should spread idle instances")
+	}
+	o.Done(b)
+	if got := pick(instances); got != b {
+		t.Fatalf("picked %s, want the instance that finished its request", got.Addr)
+	}
+	if o.Count(b) != 1 {
+		t.Fatalf("count = %d, want 1", o.Count(b))
+	}
+
+	p2c := PowerOfTwoChoicesStrategy(o)
+	for i := 0; i < 100; i++ {
+		if p2c(instances) == nil {
+			t.Fatalf("p2c returned nil")
+		}
+	}
+	if p2c(nil) != nil {
+		t.Fatalf("empty instance list should yield nil")
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	instances := newInstances(5)
+	hash := ConsistentHashStrategy(0)
+
+	before := make(map[string]*Service)
+	for i := 0; i < 1000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		svc := hash(key)(instances)
+		if again := hash(key)(instances); again != svc {
+			t.Fatalf("key %s mapped to different instances", key)
+		}
+		before[key] = svc
+	}
+
+	// 下线一个实例，只有原本落在它上面的 key 需要迁移
+	removed := instances[2]
+	remaining := append(append([]*Service{}, instances[:2]...), instances[3:]...)
+	for key, svc := range before {
+		got := hash(key)(remaining)
+		if svc != removed && got != svc {
+			t.Fatalf("key %s moved from %s to %s", key, svc.Addr, got.Addr)
+		}
+	}
+
+	// 重新生成的列表顺序不同、实例是新的对象时，映射不变且返回当前列表中的实例
+	fresh := make([]*Service, len(instances))
+	for i, svc := range instances {
+		c := *svc
+		fresh[len(instances)-1-i] = &c
+	}
+	for key, svc := range before {
+		if got := hash(key)(fresh); got.instanceID() != svc.instanceID() || got == svc {
+			t.Fatalf("key %s mapped to %p (%s), want the fresh copy of %s", key, got, got.Addr, svc.Addr)
+		}
+	}
+
+	// 列表在原地被修改后不会返回已经不在列表中的实例
+	fresh[0] = removed
+	for key := range before {
+		got := hash(key)(fresh)
+		if !slices.Contains(fresh, got) {
+			t.Fatalf("key %s mapped to %s which is not in the list", key, got.Addr)
+		}
+	}
+}
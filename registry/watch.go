@@ -0,0 +1,263 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lwm-galactic/logger"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EventType 服务实例变化类型
+type EventType int
+
+const (
+	// EventAdded 新实例上线
+	EventAdded EventType = iota + 1
+	// EventUpdated 实例信息变化，例如重新注册或修改了元数据
+	EventUpdated
+	// EventRemoved 实例下线，Service 为下线前最后一次看到的信息
+	EventRemoved
+)
+
+// String 返回事件类型名称
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventUpdated:
+		return "updated"
+	case EventRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// ServiceEvent 服务实例的增量变化
+type ServiceEvent struct {
+	Type    EventType
+	Service *Service
+}
+
+// CancelFunc 取消订阅，返回后不会再有回调；不能在回调中调用
+type CancelFunc func()
+
+const (
+	minWatchRetry = 100 * time.Millisecond
+	maxWatchRetry = 10 * time.Second
+)
+
+// SubscribeEvents 订阅服务实例的增量变化
+// 返回前同步回调一次当前所有实例（均为 EventAdded，可能为空）；之后每批变化回调一次。
+// 连接中断后从最后处理的 revision 继续 watch，不会丢失或重复事件；
+// 如果该 revision 已被压缩，则重新拉取全量列表并与本地状态比较，补发差异事件。
+func (r *EtcdRegistry) SubscribeEvents(serviceName string, handler func([]ServiceEvent)) (CancelFunc, error) {
+	// 构造监听的前缀键，以 / 结尾避免匹配到名称以 serviceName 开头的其他服务
+	watchKey := r.prefix + "/" + serviceName + "/"
+	logger.Debugf("watch key: %s", watchKey)
+
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil, ErrRegistryClosed
+	}
+	r.wg.Add(1)
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	w := &serviceWatch{
+		registry: r,
+		key:      watchKey,
+		handler:  handler,
+		state:    make(map[string]watchedService),
+	}
+	if err := w.resync(ctx); err != nil {
+		cancel()
+		r.wg.Done()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer r.wg.Done()
+		defer close(done)
+		w.run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// Subscribe 订阅服务实例的完整列表，每次变化都回调变化后的全部实例（按 ID 排序）
+// 返回前同步回调一次当前列表
+func (r *EtcdRegistry) Subscribe(serviceName string, callback func([]*Service)) (CancelFunc, error) {
+	return r.SubscribeEvents(serviceName, listHandler(callback))
+}
+
+// listHandler 将增量事件合并为完整列表
+// 各 Registry 实现都可以用它基于 SubscribeEvents 实现 Subscribe
+func listHandler(callback func([]*Service)) func([]ServiceEvent) {
+	services := make(map[string]*Service)
+	return func(events []ServiceEvent) {
+		for _, e := range events {
+			if e.Type == EventRemoved {
+				delete(services, e.Service.instanceID())
+			} else {
+				services[e.Service.instanceID()] = e.Service
+			}
+		}
+		list := make([]*Service, 0, len(services))
+		for _, svc := range services {
+			list = append(list, svc)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].instanceID() < list[j].instanceID()
+		})
+		callback(list)
+	}
+}
+
+// watchedService 本地记录的实例及其在 etcd 中的修订号
+type watchedService struct {
+	svc         *Service
+	modRevision int64
+}
+
+// serviceWatch 一个订阅的 watch 状态
+type serviceWatch struct {
+	registry *EtcdRegistry
+	key      string
+	handler  func([]ServiceEvent)
+	state    map[string]watchedService // etcd key -> 实例
+	revision int64                     // 已处理到的 revision
+}
+
+// run 持续 watch，直到 ctx 结束
+func (w *serviceWatch) run(ctx context.Context) {
+	retry := minWatchRetry
+	for {
+		compacted := false
+		wch := w.registry.client.Watch(ctx, w.key, clientv3.WithPrefix(), clientv3.WithRev(w.revision+1))
+		for resp := range wch {
+			if resp.CompactRevision != 0 {
+				compacted = true
+				break
+			}
+			if err := resp.Err(); err != nil {
+				logger.Errorf("watch %s err: %v", w.key, err)
+				break
+			}
+			w.process(resp)
+			retry = minWatchRetry
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, maxWatchRetry)
+		if compacted {
+			logger.Errorf("watch %s compacted at revision %d, resync", w.key, w.revision)
+			if err := w.resync(ctx); err != nil {
+				logger.Errorf("resync %s err: %v", w.key, err)
+			}
+		}
+	}
+}
+
+// process 处理一次 watch 响应并记录已处理到的 revision
+// 追赶历史事件时 etcd 会把事件拆成多个响应，每个响应的 Header.Revision 都是当前的 revision，
+// 因此以最后一个事件的 ModRevision 为准，只有不带事件的进度通知才使用 Header.Revision
+func (w *serviceWatch) process(resp clientv3.WatchResponse) {
+	w.apply(resp.Events)
+	if n := len(resp.Events); n > 0 {
+		w.revision = resp.Events[n-1].Kv.ModRevision
+	} else if resp.IsProgressNotify() {
+		w.revision = resp.Header.Revision
+	}
+}
+
+// resync 拉取全量列表，与本地状态比较后回调差异
+// 首次调用时本地状态为空，所有实例都是 EventAdded，即使列表为空也会回调
+func (w *serviceWatch) resync(ctx context.Context) error {
+	resp, err := w.registry.client.Get(ctx, w.key, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	first := w.revision == 0
+	now := time.Now()
+	var events []ServiceEvent
+	seen := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		seen[key] = true
+		old, ok := w.state[key]
+		if ok && old.modRevision == kv.ModRevision {
+			continue
+		}
+		svc, err := unmarshalService(kv.Value)
+		if err != nil {
+			continue // 跳过无效数据
+		}
+		// key 仍然存在说明租约未过期，实例此刻是存活的
+		svc.LastHeartbeat = now
+		w.state[key] = watchedService{svc: svc, modRevision: kv.ModRevision}
+		if ok {
+			events = append(events, ServiceEvent{Type: EventUpdated, Service: svc})
+		} else {
+			events = append(events, ServiceEvent{Type: EventAdded, Service: svc})
+		}
+	}
+	for key, old := range w.state {
+		if !seen[key] {
+			delete(w.state, key)
+			events = append(events, ServiceEvent{Type: EventRemoved, Service: old.svc})
+		}
+	}
+	w.revision = resp.Header.Revision
+	if first || len(events) > 0 {
+		w.handler(events)
+	}
+	return nil
+}
+
+// apply 将 watch 事件转换为实例变化并回调
+func (w *serviceWatch) apply(evs []*clientv3.Event) {
+	now := time.Now()
+	var events []ServiceEvent
+	for _, ev := range evs {
+		key := string(ev.Kv.Key)
+		old, ok := w.state[key]
+		switch ev.Type {
+		case mvccpb.PUT:
+			svc, err := unmarshalService(ev.Kv.Value)
+			if err != nil {
+				continue // 跳过无效数据
+			}
+			svc.LastHeartbeat = now
+			w.state[key] = watchedService{svc: svc, modRevision: ev.Kv.ModRevision}
+			if ok {
+				events = append(events, ServiceEvent{Type: EventUpdated, Service: svc})
+			} else {
+				events = append(events, ServiceEvent{Type: EventAdded, Service: svc})
+			}
+		case mvccpb.DELETE:
+			if !ok {
+				continue
+			}
+			delete(w.state, key)
+			events = append(events, ServiceEvent{Type: EventRemoved, Service: old.svc})
+		}
+	}
+	if len(events) > 0 {
+		w.handler(events)
+	}
+}
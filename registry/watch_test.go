@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestListHandler(t *testing.T) {
+	var got []*Service
+	handle := listHandler(func(services []*Service) {
+		got = services
+	})
+	a := &Service{ID: "a"}
+	b := &Service{ID: "b"}
+	handle(nil)
+	if got == nil || len(got) != 0 {
+		t.Fatalf("initial empty sync should yield an empty list, got %v", got)
+	}
+	handle([]ServiceEvent{{Type: EventAdded, Service: b}, {Type: EventAdded, Service: a}})
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Fatalf("list = %v, want sorted [a b]", got)
+	}
+	a2 := &Service{ID: "a", Version: "v2"}
+	handle([]ServiceEvent{{Type: EventUpdated, Service: a2}, {Type: EventRemoved, Service: b}})
+	if len(got) != 1 || got[0] != a2 {
+		t.Fatalf("list = %v, want [a2]", got)
+	}
+}
+
+func TestServiceWatchRevision(t *testing.T) {
+	var got []ServiceEvent
+	w := &serviceWatch{
+		key:     "/services/order/",
+		handler: func(events []ServiceEvent) { got = append(got, events...) },
+		state:   make(map[string]watchedService),
+	}
+	put := func(id string, rev int64) *clientv3.Event {
+		value, _ := (&Service{ID: id, Name: "order"}).marshal()
+		return &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{
+			Key: []byte("/services/order/" + id), Value: []byte(value), ModRevision: rev,
+		}}
+	}
+
+	// 追赶时事件被拆成多个响应，Header.Revision 都是当前的 100
+	w.process(clientv3.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: 100}, Events: []*clientv3.Event{put("a", 5), put("b", 6)}})
+	if w.revision != 6 {
+		t.Fatalf("revision = %d, want 6", w.revision)
+	}
+	w.process(clientv3.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: 100}, Created: true})
+	if w.revision != 6 {
+		t.Fatalf("revision after created response = %d, want 6", w.revision)
+	}
+	// 不带事件的进度通知表示已处理到 Header.Revision
+	w.process(clientv3.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: 100}})
+	if w.revision != 100 || len(got) != 2 {
+		t.Fatalf("revision = %d, events = %d, want 100 and 2", w.revision, len(got))
+	}
+}